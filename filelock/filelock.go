@@ -19,6 +19,16 @@ import "github.com/daviesluke/logger"
 func LockFile (fileName string, lockDuration int) {
 	logger.Infof("Putting lock on file %s ...", fileName)
 
+	if ! TryLockFile(fileName, lockDuration) {
+		logger.Errorf("Unable to lock file %s.  Exiting ...", fileName)
+	}
+
+	logger.Debug("Process complete")
+}
+
+func TryLockFile (fileName string, lockDuration int) bool {
+	logger.Debugf("Trying to lock file %s ...", fileName)
+
 	lockName := strings.Join( []string{ fileName, "locker" }, ".")
 	logger.Debugf("Lock file name set to %s", lockName)
 
@@ -57,7 +67,8 @@ func LockFile (fileName string, lockDuration int) {
 				logger.Debug("Sleeping ...")
 				time.Sleep(sleepDuration)
 			} else {
-				logger.Errorf("Unable to lock file for %d loops.  Exiting ...", loopCount)
+				logger.Warnf("Unable to lock file for %d loops", loopCount)
+				return false
 			}
                 }
         }
@@ -68,6 +79,8 @@ func LockFile (fileName string, lockDuration int) {
 	fdlock.Close()
 
 	logger.Debug("Process complete")
+
+	return true
 }
 
 func UnlockFile(fileName string) {
@@ -3,6 +3,7 @@ package logger
 // standard imports
 
 import "bufio"
+import "encoding/json"
 import "fmt"
 import "io"
 import "net/smtp"
@@ -12,6 +13,7 @@ import "path/filepath"
 import "runtime"
 import "strconv"
 import "strings"
+import "sync/atomic"
 import "time"
 
 // local imports
@@ -26,15 +28,145 @@ var database    string
 var historyFile string
 var scriptName  string
 
+// Each run is also appended to the history store as one JSON line
+
+type HistoryRecord struct {
+	Database string    `json:"db"`
+	Script   string    `json:"script"`
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_secs"`
+	Status   string    `json:"status"`
+	Errors   []string  `json:"errors,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	Input    int64     `json:"input_bytes,omitempty"`
+	Ratio    float64   `json:"compression_ratio,omitempty"`
+	JobSecs  float64   `json:"job_secs,omitempty"`
+	Job      string    `json:"job_status,omitempty"`
+}
+
+var historyStore  string
+var historyHook   func(HistoryRecord)
+var historyErrors []string
+var historyBytes  int64
+var historyInput  int64
+var historyRatio  float64
+var historyJob    string
+var historyJobSecs float64
+
+// Short notes added to the e-mail subject e.g. a slow run
+
+var notices []string
+
 var emailServer string
 
+var stderrLevel string
+
+// Syslog and journal writers add the run details to each record themselves
+
+type fieldWriter interface {
+	io.WriteCloser
+	SetFields(fields rlog.Fields)
+}
+
+var fieldWriters = map[string]fieldWriter{}
+
 var successEmails []string
 var errorEmails   []string
 
 var currentLog string
 
+// Own rlog instance so logging is configured without touching the environment
+// which is passed on to RMAN. Caller depth 1 as every call comes through here
+
+var rlogger = newLogger()
+
+// Database, script and phase are added to every line in the structured log formats
+// so a log shipper can index them. Plain text logs are left as they are
+
+var contextFields = rlog.Fields{}
+var fieldLogger   atomic.Value
+
 // Local functions
 
+func newLogger() *rlog.Logger {
+	loggerOptions := rlog.OptionsFromEnv()
+
+	loggerOptions.CallerDepth = 1
+
+	newRlogger := rlog.New(loggerOptions)
+
+	// Passwords are masked from the start, before any config is read
+
+	redactor, _ := rlog.NewRedactor(rlog.DefaultRedactPatterns...)
+
+	newRlogger.SetRedactor(redactor)
+
+	return newRlogger
+}
+
+func out() *rlog.Logger {
+	if rlogger.Format() == "TEXT" {
+		return rlogger
+	}
+
+	if contextLogger, ok := fieldLogger.Load().(*rlog.Logger); ok {
+		return contextLogger
+	}
+
+	return rlogger
+}
+
+func setContextField(fieldName string, fieldValue string) {
+	contextFields[fieldName] = fieldValue
+
+	fieldLogger.Store(rlogger.WithFields(contextFields))
+
+	for _, writer := range fieldWriters {
+		writer.SetFields(contextFields)
+	}
+}
+
+func addFieldSink(sinkName string, logLevel string, writer fieldWriter) {
+	removeFieldSink(sinkName)
+
+	writer.SetFields(contextFields)
+
+	fieldWriters[sinkName] = writer
+
+	rlogger.AddSink(sinkName, writer, rlog.SinkOptions{LogLevel: logLevel})
+}
+
+func removeFieldSink(sinkName string) {
+	if writer, ok := fieldWriters[sinkName]; ok {
+		rlogger.RemoveSink(sinkName)
+
+		writer.Close()
+
+		delete(fieldWriters, sinkName)
+	}
+}
+
+func setStream(logStream string) {
+	loggerOptions := rlogger.Options()
+
+	loggerOptions.LogStream = logStream
+
+	rlogger.SetOptions(loggerOptions)
+}
+
+// Errors always go to stderr. Drop any stderr sink first so they are not shown twice
+
+func showOnStderr() {
+	if stderrLevel != "" {
+		rlogger.RemoveSink("stderr")
+	}
+
+	setStream("STDERR")
+}
+
 func copyLog(oldLog, newLog string) {
 	trace2("Copying files ...")
 
@@ -62,19 +194,19 @@ func copyLog(oldLog, newLog string) {
 }
 
 func info(message string) {
-	rlog.Info(message)
+	out().Info(message)
 }
 
 func infof(messageFormat string, message ...interface{}) {
-	rlog.Infof(messageFormat, message)
+	out().Infof(messageFormat, message...)
 }
 
 func trace2(message string) {
-	rlog.Trace(2, message)
+	out().Trace(2, message)
 }
 
 func tracef2(messageFormat string, message ...interface{}) {
-	rlog.Tracef(2, messageFormat, message...)
+	out().Tracef(2, messageFormat, message...)
 }
 
 
@@ -104,7 +236,7 @@ func setConfFile (logConfigFileName string) {
 	if _, err := os.Stat(logConfigFileName); err == nil {
 		Debugf("File %s exists", logConfigFileName)
 		tracef2("Setting the config file to %s ...", logConfigFileName)
-		rlog.SetConfFile(logConfigFileName)
+		rlogger.SetConfFile(logConfigFileName)
 		Debugf("Config file set to %s", logConfigFileName)
 	} else {
 		Debugf("File %s does not exist", logConfigFileName)
@@ -131,13 +263,13 @@ func init () {
 func Info(message string) {
 	callingFuncName := getFunctionName()
 
-	rlog.Infof("%s - %s", callingFuncName, message)
+	out().Infof("%s - %s", callingFuncName, message)
 }
 
 func Warn(message string) {
 	callingFuncName := getFunctionName()
 
-	rlog.Warnf("%s - %s", callingFuncName, message)
+	out().Warnf("%s - %s", callingFuncName, message)
 }
 
 func Error(message string) {
@@ -145,10 +277,11 @@ func Error(message string) {
 
 	// Enable out to stream as well as file
 
-	os.Setenv("RLOG_LOG_STREAM","stderr")
-	rlog.UpdateEnv()
+	showOnStderr()
+
+	setContextField("status", "FAILURE")
 
-	rlog.Errorf("%s - %s", callingFuncName, message)
+	out().Errorf("%s - %s", callingFuncName, message)
 
 	SendLog("FAILURE")
 
@@ -162,10 +295,11 @@ func Critical(message string) {
 
 	// Enable out to stream as well as file
 
-	os.Setenv("RLOG_LOG_STREAM","stderr")
-	rlog.UpdateEnv()
+	showOnStderr()
+
+	setContextField("status", "FAILURE")
 
-	rlog.Criticalf("%s - %s", callingFuncName, message)
+	out().Criticalf("%s - %s", callingFuncName, message)
 
 	SendLog("FAILURE")
 
@@ -175,11 +309,11 @@ func Critical(message string) {
 }
 
 func Debug(message string) {
-	rlog.Debug(message)
+	out().Debug(message)
 }
 
 func Trace(message string) {
-	rlog.Trace(1, message)
+	out().Trace(1, message)
 }
 
 func Infof(messageFormat string, message ...interface{}) {
@@ -187,7 +321,7 @@ func Infof(messageFormat string, message ...interface{}) {
 
 	messageFormat = callingFuncName + " - " + messageFormat
 
-	rlog.Infof(messageFormat, message...)
+	out().Infof(messageFormat, message...)
 }
 
 func Warnf(messageFormat string, message ...interface{}) {
@@ -195,7 +329,7 @@ func Warnf(messageFormat string, message ...interface{}) {
 	
 	messageFormat = callingFuncName + " - " + messageFormat
 
-	rlog.Warnf(messageFormat, message...)
+	out().Warnf(messageFormat, message...)
 }
 
 func Errorf(messageFormat string, message ...interface{}) {
@@ -203,12 +337,13 @@ func Errorf(messageFormat string, message ...interface{}) {
 
 	// Enable out to stream as well as file
 
-	os.Setenv("RLOG_LOG_STREAM","stderr")
-	rlog.UpdateEnv()
+	showOnStderr()
+
+	setContextField("status", "FAILURE")
 
 	messageFormat = callingFuncName + " - " + messageFormat
 
-	rlog.Errorf(messageFormat, message...)
+	out().Errorf(messageFormat, message...)
 
 	SendLog("FAILURE")
 
@@ -217,17 +352,34 @@ func Errorf(messageFormat string, message ...interface{}) {
 	os.Exit(1)
 }
 
+func Skipf(messageFormat string, message ...interface{}) {
+	callingFuncName := getFunctionName()
+
+	// Nothing ran so no e-mail, only the history records the skip
+
+	setContextField("status", "SKIPPED")
+
+	messageFormat = callingFuncName + " - " + messageFormat
+
+	out().Warnf(messageFormat, message...)
+
+	WriteHistory("SKIPPED")
+
+	os.Exit(0)
+}
+
 func Criticalf(messageFormat string, message ...interface{}) {
 	callingFuncName := getFunctionName()
 
 	// Enable out to stream as well as file
 
-	os.Setenv("RLOG_LOG_STREAM","stderr")
-	rlog.UpdateEnv()
+	showOnStderr()
+
+	setContextField("status", "FAILURE")
 
 	messageFormat = callingFuncName + " - " + messageFormat
 
-	rlog.Criticalf(messageFormat, message...)
+	out().Criticalf(messageFormat, message...)
 
 	SendLog("FAILURE")
 
@@ -237,11 +389,11 @@ func Criticalf(messageFormat string, message ...interface{}) {
 }
 
 func Debugf(messageFormat string, message ...interface{}) {
-	rlog.Debugf(messageFormat, message...)
+	out().Debugf(messageFormat, message...)
 }
 
 func Tracef(messageFormat string, message ...interface{}) {
-	rlog.Tracef(1, messageFormat, message...)
+	out().Tracef(1, messageFormat, message...)
 }
 
 func Initialize(logDir string, logFileName string, logConfigFileName string) {
@@ -251,31 +403,27 @@ func Initialize(logDir string, logFileName string, logConfigFileName string) {
 	//
 	trace2("Checking logging level ...")
 
-	if rlog.CheckLevel("DEBUG") {
-		trace2("Checking environment variable RLOG_LOG_LEVEL ...")
+	loggerOptions := rlogger.Options()
 
-		envVar := os.Getenv("RLOG_LOG_LEVEL")
-		if envVar == "" {
-			trace2("Tracing on but not at debug log level. Setting RLOG_LOG_LEVEL to DEBUG ...")
+	if rlogger.CheckLevel("DEBUG") {
+		trace2("Checking log level ...")
 
-			os.Setenv("RLOG_LOG_LEVEL", "DEBUG")
+		if loggerOptions.LogLevel == "" {
+			trace2("Tracing on but not at debug log level. Setting log level to DEBUG ...")
 
-			trace2("RLOG_LOG_LEVEL set to DEBUG")
+			loggerOptions.LogLevel = "DEBUG"
+
+			trace2("Log level set to DEBUG")
 		} else {
-			tracef2("RLOG_LOG_LEVEL set to %s",envVar)
+			tracef2("Log level set to %s",loggerOptions.LogLevel)
 		}
 
 		trace2("Log Level set to DEBUG or lower")
-		trace2("Increasing logging information by setting RLOG_CALLER_INFO to yes")
-
-		os.Setenv("RLOG_CALLER_INFO", "yes")
+		trace2("Increasing logging information by turning on caller info")
 
-		trace2("RLOG_CALLER_INFO set to yes")
-		trace2("Updating the environment ...")
+		loggerOptions.CallerInfo = true
 
-		rlog.UpdateEnv()
-
-		trace2("Environment updated")
+		trace2("Caller info turned on")
 	}
 
 	//
@@ -324,26 +472,25 @@ func Initialize(logDir string, logFileName string, logConfigFileName string) {
 	//
 	// Set the output to the log file
 	//
-	tracef2("Setting the variable RLOG_LOG_FILE to %s ...",logFileName)
-	os.Setenv("RLOG_LOG_FILE",logFileName)
+	tracef2("Setting the log file to %s ...",logFileName)
+	loggerOptions.LogFile = logFileName
 
 	// 
 	// Turn off logging to the stderr if trace is switched off
 	//
-	trace2("Getting environment variable RLOG_TRACE_LEVEL")
-	rlogTraceLevel := os.Getenv("RLOG_TRACE_LEVEL")
+	trace2("Checking trace level")
 
-	if rlogTraceLevel == "" {
-		trace2("RLOG_TRACE_LEVEL not set ...")
-		trace2("Setting the variable RLOG_LOG_STREAM to none")
-		os.Setenv("RLOG_LOG_STREAM","none")
+	if loggerOptions.TraceLevel == "" {
+		trace2("Trace level not set ...")
+		trace2("Setting the log stream to none")
+		loggerOptions.LogStream = "NONE"
 	} else {
-		tracef2("RLOG_TRACE_LEVEL set to %s. Leaving RLOG streaming on ...", rlogTraceLevel)
+		tracef2("Trace level set to %s. Leaving streaming on ...", loggerOptions.TraceLevel)
 	}
 		
-	trace2("Updating environment")
-	rlog.UpdateEnv()
-	trace2("Environment updated")
+	trace2("Updating logger options")
+	rlogger.SetOptions(loggerOptions)
+	trace2("Logger options updated")
 	Debugf("Log file %s should now be open", logFileName)
 
 	setConfFile(logConfigFileName)
@@ -351,6 +498,22 @@ func Initialize(logDir string, logFileName string, logConfigFileName string) {
 	currentLog = logFileName
 }
 
+func moveSegments(oldLog, newLog string) {
+	trace2("Moving rotated log segments ...")
+
+	segments, _ := filepath.Glob(oldLog + ".*")
+
+	for _, segment := range segments {
+		suffix := strings.TrimPrefix(segment, oldLog)
+
+		if err := os.Rename(segment, newLog + suffix); err != nil {
+			Warnf("Unable to move log segment %s - %s", segment, err)
+		}
+	}
+
+	trace2("Segments moved")
+}
+
 func RenameLog(oldLogFileName string , newLogFileName string, logConfigFileName string ) {
 	Infof("Renaming log %s to %s ...", oldLogFileName, newLogFileName)
 
@@ -361,7 +524,7 @@ func RenameLog(oldLogFileName string , newLogFileName string, logConfigFileName
 
 	// Redirect output to stdout
 
-	rlog.SetOutput(os.Stdout)
+	rlogger.SetOutput(os.Stdout)
 	trace2("Redirected output to stderr")
 
 	// File should be closed - ready to rename
@@ -375,9 +538,14 @@ func RenameLog(oldLogFileName string , newLogFileName string, logConfigFileName
 		Errorf("Unable to remove old log file %s", oldLogFileName)
 	}
 
+	// Keep any rotated segments with the log
+
+	moveSegments(oldLogFileName, newLogFileName)
+
 	// Turn on output
-	os.Setenv("RLOG_LOG_FILE",newLogFileName)
-	rlog.UpdateEnv()
+	loggerOptions := rlogger.Options()
+	loggerOptions.LogFile = newLogFileName
+	rlogger.SetOptions(loggerOptions)
 	trace2("Turned on logging")
 
 	setConfFile(logConfigFileName)
@@ -395,9 +563,12 @@ func CopyFileToLog(title string, fileName string, logConfigFileName string) {
 	info(title)
 
 	// Turn off some output logging
-	
-	os.Setenv("RLOG_LOG_NOTIME","yes")
-	rlog.UpdateEnv()
+
+	loggerOptions := rlogger.Options()
+
+	noTimeOptions := loggerOptions
+	noTimeOptions.NoTime = true
+	rlogger.SetOptions(noTimeOptions)
 
 	Debug("Not logging time now")
 
@@ -413,8 +584,7 @@ func CopyFileToLog(title string, fileName string, logConfigFileName string) {
 		Errorf("Unable to open file %s - %s", fileName, err)
 	}
 
-	os.Unsetenv("RLOG_LOG_NOTIME")
-	rlog.UpdateEnv()
+	rlogger.SetOptions(loggerOptions)
 	setConfFile(logConfigFileName)
 	
 	Debug("Process complete")
@@ -424,21 +594,48 @@ func SetStartTime () {
 	startTime = time.Now()
 }
 
-func SetHistoryVars ( fileName string, db string, funcName string ) {
+func Elapsed () time.Duration {
+	return time.Since(startTime)
+}
+
+func AddNotice ( notice string ) {
+	Tracef("Adding notice %s ...", notice)
+
+	notices = append(notices, notice)
+
+	Trace("Process complete")
+}
+
+func SetHistoryVars ( fileName string, storeName string, db string, funcName string ) {
 	Trace("Setting history variables ...")
 
 	historyFile = fileName
+	historyStore = storeName
 	database    = db
 	scriptName  = funcName
 
-	Tracef("Settings: History file %s, Database %s, scriptName %s", historyFile, database, scriptName)
+	setContextField("database", database)
+	setContextField("script", scriptName)
+	setContextField("status", "RUNNING")
+
+	Tracef("Settings: History file %s, History store %s, Database %s, scriptName %s", historyFile, historyStore, database, scriptName)
 
 	Trace("Process complete")
 }
 	
+func SetPhase ( phase string ) {
+	Tracef("Setting phase to %s ...", phase)
+
+	setContextField("phase", phase)
+
+	Trace("Process complete")
+}
+
 func WriteHistory (status string) {
 	Trace("Writing history file ...")
 
+	setContextField("status", status)
+
 	if history, err := os.OpenFile(historyFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND , 0600); err == nil {
 		
 		timeDiff := time.Since(startTime)
@@ -456,6 +653,109 @@ func WriteHistory (status string) {
 		Tracef("Unable to open file %s - %s", historyFile, err)
 	}
 
+	writeHistoryStore(status)
+
+	Trace("Process complete")
+}
+
+func writeHistoryStore (status string) {
+	Trace("Writing history store ...")
+
+	if historyStore == "" {
+		Trace("No history store set")
+		return
+	}
+
+	historyRecord := newHistoryRecord(status)
+
+	// Anything else wanting the run details e.g. metrics, after the store is written
+
+	if historyHook != nil {
+		defer historyHook(historyRecord)
+	}
+
+	recordLine, err := json.Marshal(historyRecord)
+	if err != nil {
+		Tracef("Unable to encode history record - %s", err)
+		return
+	}
+
+	// A single append of the whole line so concurrent runs do not interleave
+
+	if store, err := os.OpenFile(historyStore, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640); err == nil {
+		store.Write(append(recordLine, '\n'))
+
+		store.Sync()
+
+		store.Close()
+	} else {
+		Tracef("Unable to open file %s - %s", historyStore, err)
+	}
+
+	Trace("Process complete")
+}
+
+func newHistoryRecord (status string) HistoryRecord {
+	endTime := time.Now()
+
+	hostName, _ := os.Hostname()
+
+	return HistoryRecord{
+		Database: database,
+		Script:   scriptName,
+		Host:     hostName,
+		PID:      os.Getpid(),
+		Start:    startTime,
+		End:      endTime,
+		Duration: endTime.Sub(startTime).Seconds(),
+		Status:   status,
+		Errors:   historyErrors,
+		Bytes:    historyBytes,
+		Input:    historyInput,
+		Ratio:    historyRatio,
+		JobSecs:  historyJobSecs,
+		Job:      historyJob,
+	}
+}
+
+func SetHistoryHook ( hook func(HistoryRecord) ) {
+	Trace("Setting history hook ...")
+
+	historyHook = hook
+
+	Trace("Process complete")
+}
+
+func AddHistoryErrors ( errorCodes []string ) {
+	Trace("Adding error codes to history ...")
+
+	for _, errorCode := range errorCodes {
+		found := false
+
+		for _, historyError := range historyErrors {
+			if historyError == errorCode {
+				found = true
+				break
+			}
+		}
+
+		if ! found {
+			historyErrors = append(historyErrors, errorCode)
+		}
+	}
+
+	Trace("Process complete")
+}
+
+func SetHistoryJob ( jobStatus string, inputBytes int64, outputBytes int64, compressionRatio float64, jobSecs float64 ) {
+	Trace("Setting backup job details for history ...")
+
+	historyJob   = jobStatus
+	historyInput = inputBytes
+	historyBytes = outputBytes
+	historyRatio = compressionRatio
+	historyJobSecs = jobSecs
+
 	Trace("Process complete")
 }
 
@@ -467,6 +767,69 @@ func SetEmailServer( serverString string ) {
 	Trace("Process complete")
 }
 
+func SetStderrLevel( logLevel string ) {
+	Trace("Setting the stderr log level ...")
+
+	stderrLevel = logLevel
+
+	if stderrLevel == "" {
+		rlogger.RemoveSink("stderr")
+	} else {
+		rlogger.AddSink("stderr", os.Stderr, rlog.SinkOptions{LogLevel: stderrLevel, LogFormat: "TEXT"})
+	}
+
+	Trace("Process complete")
+}
+
+func SetSyslog( logLevel string, address string, facility string ) {
+	Trace("Setting the syslog log level ...")
+
+	if logLevel == "" {
+		removeFieldSink("syslog")
+	} else if writer, err := rlog.NewSyslogWriter(address, facility, ""); err != nil {
+		Warnf("Unable to log to syslog at %s - %s", address, err)
+	} else {
+		addFieldSink("syslog", logLevel, writer)
+	}
+
+	Trace("Process complete")
+}
+
+func SetJournal( logLevel string ) {
+	Trace("Setting the journal log level ...")
+
+	if logLevel == "" {
+		removeFieldSink("journal")
+	} else if writer, err := rlog.NewJournalWriter("", ""); err != nil {
+		Warnf("Unable to log to the systemd journal - %s", err)
+	} else {
+		addFieldSink("journal", logLevel, writer)
+	}
+
+	Trace("Process complete")
+}
+
+func SetRedactPatterns( patternList string ) {
+	Trace("Setting the redaction patterns ...")
+
+	patterns := rlog.DefaultRedactPatterns
+
+	if patternList != "" {
+		patterns = append(append([]string{}, patterns...), strings.Split(patternList, ";")...)
+	}
+
+	redactor, err := rlog.NewRedactor(patterns...)
+	if err != nil {
+		Errorf("Invalid redaction pattern in %s - %s", patternList, err)
+	}
+
+	rlogger.SetRedactor(redactor)
+
+	Tracef("%d redaction patterns set", len(patterns))
+
+	Trace("Process complete")
+}
+
 func SetEmailRecipients( errorList []string, successList []string ) {
 	Trace("Setting the e-mail recipients ...")
 
@@ -494,7 +857,7 @@ func SendLog (status string) {
 		
 		// Redirect output to stdout and close log file
 
-		rlog.SetOutput(os.Stdout)
+		rlogger.SetOutput(os.Stdout)
 		trace2("Redirected output to stderr")
 
 		// Connect to the SMTP server.
@@ -549,7 +912,17 @@ func SendLog (status string) {
 
 		timeDiff := time.Since(startTime)
 
-		fmt.Fprintf(body, "Subject: %s for DB %s. Script %s. Completed with status %s in %0.2f hours\r\n\r\n", baseName, database, scriptName, status, timeDiff.Hours())
+		subjectNotices := ""
+
+		if len(notices) > 0 {
+			subjectNotices = " - " + strings.Join(notices, ", ")
+		}
+
+		fmt.Fprintf(body, "Subject: %s for DB %s. Script %s. Completed with status %s in %0.2f hours%s\r\n\r\n", baseName, database, scriptName, status, timeDiff.Hours(), subjectNotices)
+
+		if historyJob != "" {
+			fmt.Fprintf(body, "RMAN status %s. Read %d bytes, wrote %d bytes, compression ratio %.2f in %.0f seconds\r\n\r\n", historyJob, historyInput, historyBytes, historyRatio, historyJobSecs)
+		}
 
 		// Send the log file 
 
@@ -117,6 +117,8 @@ func ParseDSN(dsnString string) (dsn *DSN, err error) {
 				dsn.operationMode = C.OCI_SYSASM
 			case "SYSOPER", "sysoper":
 				dsn.operationMode = C.OCI_SYSOPER
+			case "SYSBACKUP", "sysbackup":
+				dsn.operationMode = C.OCI_SYSBKP
 			default:
 				return nil, fmt.Errorf("Invalid as: %v", v[0])
 			}
@@ -124,7 +126,8 @@ func ParseDSN(dsnString string) (dsn *DSN, err error) {
 		}
 	}
 
-	if len(dsn.Username)+len(dsn.Password)+len(dsn.Connect) == 0 {
+	// No user or password is external authentication, with a connect string for a wallet alias
+	if len(dsn.Username)+len(dsn.Password) == 0 {
 		dsn.externalauthentication = true
 	}
 	return dsn, nil
@@ -216,7 +219,7 @@ func (oci8Driver *OCI8DriverStruct) Open(dsnString string) (connection driver.Co
 			// conn allocations: env, err, srv
 		}
 
-		if dsn.externalauthentication {
+		if len(dsn.Connect) == 0 {
 			C.WrapOCIServerAttach(
 				conn.srv,
 				conn.err,
@@ -106,6 +106,18 @@
 //   ':'. Note that calculation of the goroutine ID has a performance impact, so
 //   please only enable this option if needed.
 //
+// * RLOG_LOG_FORMAT: TEXT, JSON or LOGFMT. See STRUCTURED OUTPUT below.
+//   Default: TEXT.
+//
+// * RLOG_LOG_MAX_SIZE: Size at which the log file is rotated, in bytes or with
+//   a K, M or G suffix. The file is renamed to <file>.1, older segments move up
+//   one and a new file is started. Default: Not set - the file is not rotated.
+//
+// * RLOG_LOG_MAX_SEGMENTS: Number of rotated segments kept. Default: 5.
+//
+// * RLOG_LOG_COMPRESS: If this evaluates to 'true' then rotated segments are
+//   gzipped to <file>.1.gz and so on. Default: No.
+//
 // * RLOG_TIME_FORMAT: Use this variable to customize the date/time format. The
 //   format is specified either by the well known formats listed in
 //   https://golang.org/src/time/format.go, for example "UnixDate" or "RFC3339".
@@ -312,6 +324,91 @@
 // trace level.
 //
 //
+// LOGGER INSTANCES
+//
+// The package level functions log through a default Logger configured from the
+// environment variables above. A program which would rather not change its
+// own environment to reconfigure logging can create its own Logger with
+// explicit options:
+//
+//     logger := rlog.New(rlog.Options{
+//         LogLevel:  "DEBUG",
+//         LogFile:   "/tmp/example.log",
+//         LogStream: "NONE",
+//     })
+//     logger.Info("Logged to the file only")
+//
+// Start from rlog.OptionsFromEnv() to take the environment variables as a
+// base. Options() and SetOptions() read and change a Logger's options at any
+// time. A package which wraps rlog in its own log functions sets CallerDepth
+// to the number of extra stack frames it adds, so that caller info and per
+// file filters refer to the code calling the wrapper.
+//
+// WithFields returns a Logger which adds key=value pairs after the message of
+// every line it logs, sharing the configuration and outputs of its parent:
+//
+//     logger.WithFields(rlog.Fields{"database": "ORCL"}).Info("Backup started")
+//
+//     INFO     : Backup started database=ORCL
+//
+// The Infow style functions take the fields as alternating keys and values:
+//
+//     logger.Infow("Backup started", "database", "ORCL", "phase", "rman")
+//
+//
+// STRUCTURED OUTPUT
+//
+// Set RLOG_LOG_FORMAT (or Options.LogFormat) to JSON or LOGFMT to write each
+// line as a record with the keys time, level, pid, goroutine, file, line, func
+// and msg, followed by any fields. Trace records also have a trace key with
+// the trace level. A field with the same name as one of those keys is written
+// as fields.<name>. The default format is TEXT.
+//
+//     {"time":"2017-11-16T08:08:49+13:00","level":"INFO","pid":1234,...,"msg":"Backup started","database":"ORCL"}
+//
+//     time=2017-11-16T08:08:49+13:00 level=INFO pid=1234 ... msg="Backup started" database=ORCL
+//
+// SINKS
+//
+// Besides the stream and log file a Logger can write to any number of named
+// sinks, each with its own log and trace level filters and format. Sinks are
+// not affected by the RLOG_* settings or by SetOutput.
+//
+//     recent := rlog.NewRingBuffer(100)
+//     logger.AddSink("stderr", os.Stderr, rlog.SinkOptions{LogLevel: "WARN"})
+//     logger.AddSink("recent", recent, rlog.SinkOptions{LogLevel: "DEBUG", LogFormat: "JSON"})
+//
+// An empty LogLevel means INFO and an empty TraceLevel means no trace output.
+// RemoveSink takes a sink away again. A RingBuffer keeps the most recent lines
+// in memory and returns them with Lines.
+//
+// SyslogWriter (RFC 5424 over a unix socket such as /dev/log or UDP) and
+// JournalWriter (the systemd journal) take each record as a Record instead
+// of a formatted line. They map levels to syslog severities and send fields,
+// plus any set on the writer with SetFields, as structured data or journal
+// fields with upper case names.
+//
+//     writer, err := rlog.NewSyslogWriter("unix:/dev/log", "LOCAL0", "")
+//     if err == nil {
+//         writer.SetFields(rlog.Fields{"database": "ORCL"})
+//         logger.AddSink("syslog", writer, rlog.SinkOptions{LogLevel: "INFO"})
+//     }
+//
+//
+// REDACTION
+//
+// SetRedactor sets a function through which every message, and any string
+// field values, pass before they reach any output. NewRedactor builds one from
+// regular expressions, masking the parts of each match in parentheses (or the
+// whole match if there are none). DefaultRedactPatterns mask passwords in
+// connection strings, after "identified by" and in URLs.
+//
+//     redactor, err := rlog.NewRedactor(rlog.DefaultRedactPatterns...)
+//     if err == nil {
+//         logger.SetRedactor(redactor)
+//     }
+//
+//
 // USAGE EXAMPLE
 //
 //     import "github.com/romana/rlog"
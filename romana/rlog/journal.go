@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJournalAddress is the socket of the systemd journal.
+const DefaultJournalAddress = "/run/systemd/journal/socket"
+
+// JournalWriter sends records to the systemd journal using its native
+// protocol, with the fields as journal fields. Use it as a sink with AddSink.
+// Records too large for one datagram are not sent.
+type JournalWriter struct {
+	recordFields
+	mutex   sync.Mutex
+	conn    *net.UnixConn
+	appName string
+}
+
+// NewJournalWriter connects to the journal. An empty address means
+// DefaultJournalAddress and an empty name the program name.
+func NewJournalWriter(address string, name string) (*JournalWriter, error) {
+	if address == "" {
+		address = DefaultJournalAddress
+	}
+	if name == "" {
+		name = appName()
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: strings.TrimPrefix(address, "unix:"), Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWriter{conn: conn, appName: name}, nil
+}
+
+// WriteRecord sends one record.
+func (writer *JournalWriter) WriteRecord(record Record) error {
+	var message bytes.Buffer
+
+	names, values := writer.merged(record.Fields)
+	journalField(&message, "MESSAGE", record.Msg)
+	journalField(&message, "PRIORITY", strconv.Itoa(syslogSeverity(record.Level)))
+	journalField(&message, "SYSLOG_IDENTIFIER", writer.appName)
+	if record.File != "" {
+		journalField(&message, "CODE_FILE", record.File)
+		journalField(&message, "CODE_LINE", strconv.Itoa(record.Line))
+		journalField(&message, "CODE_FUNC", record.Func)
+	}
+	for _, name := range names {
+		journalField(&message, name, values[name])
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	_, err := writer.conn.Write(message.Bytes())
+	return err
+}
+
+// journalField adds a field to a message. Values with new lines are sent
+// with their length in front, as the journal protocol requires.
+func journalField(message *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		message.WriteString(name + "=" + value + "\n")
+		return
+	}
+	message.WriteString(name + "\n")
+	binary.Write(message, binary.LittleEndian, uint64(len(value)))
+	message.WriteString(value + "\n")
+}
+
+// Write sends a formatted line at INFO priority, for use as a plain writer.
+func (writer *JournalWriter) Write(p []byte) (int, error) {
+	err := writer.WriteRecord(Record{Time: time.Now(), Level: "INFO", TraceLevel: notATrace,
+		Msg: strings.TrimSuffix(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (writer *JournalWriter) Close() error {
+	return writer.conn.Close()
+}
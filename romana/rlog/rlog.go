@@ -18,6 +18,7 @@ package rlog
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -25,6 +26,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -100,36 +102,99 @@ type rlogConfig struct {
 	showCallerInfo  string // Flag to determine if caller info is logged
 	showGoroutineID string // Flag to determine if goroute ID shows in caller info
 	confCheckInterv string // Interval in seconds for checking config file
+	logFormat       string // Line format: TEXT, JSON or LOGFMT
+	logMaxSize      string // Size at which the log file is rotated
+	logMaxSegments  string // Number of rotated log files kept
+	logCompress     string // Flag to determine if rotated log files are gzipped
 }
 
-// We keep a copy of what was supplied via environment variables, since we will
-// consult this every time we read from a config file. This allows us to
-// determine which values take precedence.
-var configFromEnvVars rlogConfig
+// Options configures a Logger explicitly rather than through environment
+// variables. The string values take the same form as the matching RLOG_*
+// variables. Values in the config file, if one is given, fill in anything left
+// empty here unless the file entry starts with '!'.
+type Options struct {
+	LogLevel          string        // As RLOG_LOG_LEVEL, e.g. "DEBUG" or "client.go=WARN,INFO"
+	TraceLevel        string        // As RLOG_TRACE_LEVEL. Empty means no trace output
+	TimeFormat        string        // As RLOG_TIME_FORMAT
+	LogFile           string        // As RLOG_LOG_FILE. Empty means no log file
+	LogStream         string        // STDERR (the default), STDOUT or NONE
+	ConfFile          string        // As RLOG_CONF_FILE. Empty means no config file
+	ConfCheckInterval time.Duration // How often to re-read ConfFile. 0 is 15s, negative never
+	LogFormat         string        // As RLOG_LOG_FORMAT: TEXT (the default), JSON or LOGFMT
+	NoTime            bool          // As RLOG_LOG_NOTIME
+	CallerInfo        bool          // As RLOG_CALLER_INFO
+	GoroutineID       bool          // As RLOG_GOROUTINE_ID
+	CallerDepth       int           // Extra stack frames to skip when a wrapper calls rlog
+	MaxSize           int64         // As RLOG_LOG_MAX_SIZE in bytes. 0 means no rotation
+	MaxSegments       int           // As RLOG_LOG_MAX_SEGMENTS. 0 means 5
+	Compress          bool          // As RLOG_LOG_COMPRESS
+}
+
+// Fields are key/value pairs added to each log line of a Logger, after the
+// message.
+type Fields map[string]interface{}
 
+// loggerCore holds the running configuration and outputs of a Logger. It is
+// shared by a Logger and any Loggers derived from it with WithFields, so that
+// reconfiguring one reconfigures all of them.
+//
 // The configuration items in rlogConfig are what is supplied by the user
-// (usually via environment variables). They are not the actual running
-// configuration.  We interpret this, combine it with configuration from the
+// (via Options or environment variables). They are not the actual running
+// configuration. We interpret this, combine it with configuration from the
 // config file and produce pre-processed configuration values, which are stored
-// in those variables below.
-var (
+// in the setting fields below.
+type loggerCore struct {
+	// We keep a copy of what was supplied, since we will consult this every
+	// time we read from a config file. This allows us to determine which
+	// values take precedence.
+	suppliedConfig rlogConfig
+
+	callerDepth            int    // extra frames between the caller and rlog
 	settingShowCallerInfo  bool   // whether we log caller info
 	settingShowGoroutineID bool   // whether we show goroutine ID in caller info
 	settingDateTimeFormat  string // flags for date/time output
 	settingConfFile        string // config file name
-	// how often we check the conf file
-	settingCheckInterval time.Duration = 15 * time.Second
+	settingCheckInterval   time.Duration // how often we check the conf file
+	settingLogFormat       string // TEXT, JSON or LOGFMT
+	settingMaxSize         int64  // size at which the log file is rotated
+	settingMaxSegments     int    // number of rotated log files kept
+	settingCompress        bool   // whether rotated log files are gzipped
 
 	logWriterStream     *log.Logger // the first writer to which output is sent
 	logWriterFile       *log.Logger // the second writer to which output is sent
 	logFilterSpec       *filterSpec // filters for log messages
 	traceFilterSpec     *filterSpec // filters for trace messages
 	lastConfigFileCheck time.Time   // when did we last check the config file
-	currentLogFile      *os.File    // the logfile currently in use
+	currentLogFile      *rotatingFile // the logfile currently in use
 	currentLogFileName  string      // name of current log file
+	sinks               []*sink     // further outputs with their own filters
+	redactor            func(string) string // masks secrets in messages
 
-	initMutex sync.RWMutex = sync.RWMutex{} // used to protect the init section
-)
+	initMutex sync.RWMutex // used to protect the init section
+}
+
+// Logger writes log and trace messages according to its own configuration.
+// The package level functions use a default Logger configured from the RLOG_*
+// environment variables.
+type Logger struct {
+	core   *loggerCore
+	fields Fields
+}
+
+/*
+###########################################################################
+##  Moved the configuration and outputs from package variables onto a Logger
+##  so that a program can configure logging explicitly instead of by
+##  changing its own environment.  The package functions use a default
+##  Logger so existing callers are unchanged.
+##
+##  Luke - 18th October 2026
+##
+###########################################################################
+*/
+
+// defaultLogger is used by the package level functions.
+var defaultLogger = &Logger{core: newCore()}
 
 // fromString initializes filterSpec from string.
 //
@@ -280,18 +345,17 @@ func updateIfNeeded(oldVal string, newVal string, priority bool) string {
 
 // updateConfigFromFile reads a configuration from the specified config file.
 // It merges the supplied config with the new values.
-func updateConfigFromFile(config *rlogConfig) {
-	lastConfigFileCheck = time.Now()
+func (core *loggerCore) updateConfigFromFile(config *rlogConfig) {
+	core.lastConfigFileCheck = time.Now()
 
-	settingConfFile = config.confFile
-	// If no config file was specified we will default to a known location.
-	if settingConfFile == "" {
-		execName := filepath.Base(os.Args[0])
-		settingConfFile = fmt.Sprintf("/etc/rlog/%s.conf", execName)
+	core.settingConfFile = config.confFile
+	// If no config file was specified then there is nothing to merge.
+	if core.settingConfFile == "" {
+		return
 	}
 
 	// Scan over the config file, line by line
-	file, err := os.Open(settingConfFile)
+	file, err := os.Open(core.settingConfFile)
 	if err != nil {
 		// Any error while attempting to open the logfile ignored. In many
 		// cases there won't even be a config file, so we should not produce
@@ -314,7 +378,7 @@ func updateConfigFromFile(config *rlogConfig) {
 		}
 		if len(tokens) != 2 {
 			rlogIssue("Malformed line in config file %s:%d. Ignored.",
-				settingConfFile, i)
+				core.settingConfFile, i)
 			continue
 		}
 		name := strings.TrimSpace(tokens[0])
@@ -346,9 +410,18 @@ func updateConfigFromFile(config *rlogConfig) {
 			config.showCallerInfo = updateIfNeeded(config.showCallerInfo, val, priority)
 		case "RLOG_GOROUTINE_ID":
 			config.showGoroutineID = updateIfNeeded(config.showGoroutineID, val, priority)
+		case "RLOG_LOG_FORMAT":
+			val = strings.ToUpper(val)
+			config.logFormat = updateIfNeeded(config.logFormat, val, priority)
+		case "RLOG_LOG_MAX_SIZE":
+			config.logMaxSize = updateIfNeeded(config.logMaxSize, val, priority)
+		case "RLOG_LOG_MAX_SEGMENTS":
+			config.logMaxSegments = updateIfNeeded(config.logMaxSegments, val, priority)
+		case "RLOG_LOG_COMPRESS":
+			config.logCompress = updateIfNeeded(config.logCompress, val, priority)
 		default:
 			rlogIssue("Unknown or illegal setting name in config file %s:%d. Ignored.",
-				settingConfFile, i)
+				core.settingConfFile, i)
 		}
 	}
 }
@@ -356,7 +429,7 @@ func updateConfigFromFile(config *rlogConfig) {
 // configFromEnv extracts settings for our logger from environment variables.
 func configFromEnv() rlogConfig {
 	// Read the initial configuration from the environment variables
-	return rlogConfig{
+	config := rlogConfig{
 		logLevel:        os.Getenv("RLOG_LOG_LEVEL"),
 		traceLevel:      os.Getenv("RLOG_TRACE_LEVEL"),
 		logTimeFormat:   os.Getenv("RLOG_TIME_FORMAT"),
@@ -367,7 +440,86 @@ func configFromEnv() rlogConfig {
 		showCallerInfo:  os.Getenv("RLOG_CALLER_INFO"),
 		showGoroutineID: os.Getenv("RLOG_GOROUTINE_ID"),
 		confCheckInterv: os.Getenv("RLOG_CONF_CHECK_INTERVAL"),
+		logFormat:       strings.ToUpper(os.Getenv("RLOG_LOG_FORMAT")),
+		logMaxSize:      os.Getenv("RLOG_LOG_MAX_SIZE"),
+		logMaxSegments:  os.Getenv("RLOG_LOG_MAX_SEGMENTS"),
+		logCompress:     os.Getenv("RLOG_LOG_COMPRESS"),
+	}
+	// If no config file was specified we will default to a known location.
+	if config.confFile == "" {
+		execName := filepath.Base(os.Args[0])
+		config.confFile = fmt.Sprintf("/etc/rlog/%s.conf", execName)
 	}
+	return config
+}
+
+// configFromOptions translates explicit options into the same form as the
+// environment variables.
+func configFromOptions(opts Options) rlogConfig {
+	config := rlogConfig{
+		logLevel:      opts.LogLevel,
+		traceLevel:    opts.TraceLevel,
+		logTimeFormat: opts.TimeFormat,
+		logFile:       opts.LogFile,
+		confFile:      opts.ConfFile,
+		logStream:     strings.ToUpper(opts.LogStream),
+		logFormat:     strings.ToUpper(opts.LogFormat),
+	}
+	// Unset flags are left empty so that a config file can still set them
+	if opts.NoTime {
+		config.logNoTime = "yes"
+	}
+	if opts.CallerInfo {
+		config.showCallerInfo = "yes"
+	}
+	if opts.GoroutineID {
+		config.showGoroutineID = "yes"
+	}
+	if opts.ConfCheckInterval != 0 {
+		config.confCheckInterv = strconv.Itoa(int(opts.ConfCheckInterval / time.Second))
+	}
+	if opts.MaxSize != 0 {
+		config.logMaxSize = strconv.FormatInt(opts.MaxSize, 10)
+	}
+	if opts.MaxSegments != 0 {
+		config.logMaxSegments = strconv.Itoa(opts.MaxSegments)
+	}
+	if opts.Compress {
+		config.logCompress = "yes"
+	}
+	return config
+}
+
+// optionsFromConfig is the reverse of configFromOptions.
+func optionsFromConfig(config rlogConfig, callerDepth int) Options {
+	opts := Options{
+		LogLevel:    config.logLevel,
+		TraceLevel:  config.traceLevel,
+		TimeFormat:  config.logTimeFormat,
+		LogFile:     config.logFile,
+		LogStream:   config.logStream,
+		ConfFile:    config.confFile,
+		LogFormat:   config.logFormat,
+		NoTime:      isTrueBoolString(config.logNoTime),
+		CallerInfo:  isTrueBoolString(config.showCallerInfo),
+		GoroutineID: isTrueBoolString(config.showGoroutineID),
+		CallerDepth: callerDepth,
+		Compress:    isTrueBoolString(config.logCompress),
+	}
+	if maxSize, err := parseSize(config.logMaxSize); err == nil {
+		opts.MaxSize = maxSize
+	}
+	if maxSegments, err := strconv.Atoi(config.logMaxSegments); err == nil {
+		opts.MaxSegments = maxSegments
+	}
+	if checkTime, err := strconv.Atoi(config.confCheckInterv); err == nil {
+		opts.ConfCheckInterval = time.Duration(checkTime) * time.Second
+		if checkTime == 0 {
+			// Zero seconds means never, which is negative in Options
+			opts.ConfCheckInterval = -1
+		}
+	}
+	return opts
 }
 
 // init loads configuration from the environment variables and the
@@ -376,10 +528,20 @@ func init() {
 	UpdateEnv()
 }
 
+// newCore returns an unconfigured loggerCore with the default settings.
+func newCore() *loggerCore {
+	return &loggerCore{
+		settingCheckInterval: 15 * time.Second,
+		settingLogFormat:     "TEXT",
+		logFilterSpec:        new(filterSpec),
+		traceFilterSpec:      new(filterSpec),
+	}
+}
+
 // getTimeFormat returns the time format we should use for time stamps in log
 // lines, or nothing if "no time logging" has been requested.
 func getTimeFormat(config rlogConfig) string {
-	settingDateTimeFormat = ""
+	dateTimeFormat := ""
 	logNoTime := isTrueBoolString(config.logNoTime)
 	if !logNoTime {
 		// Store the format string for date/time logging. Allowed values are
@@ -414,9 +576,9 @@ func getTimeFormat(config rlogConfig) string {
 				f = time.RFC3339
 			}
 		}
-		settingDateTimeFormat = f + " "
+		dateTimeFormat = f + " "
 	}
-	return settingDateTimeFormat
+	return dateTimeFormat
 }
 
 // initialize translates config items into initialized data structures,
@@ -426,45 +588,72 @@ func getTimeFormat(config rlogConfig) string {
 // Importantly, it takes the passed in configuration and combines it with any
 // configuration provided in a configuration file.
 // If the reInitEnvVars flag is set then the passed-in configuration overwrites
-// the settings stored from the environment variables, which we need for our tests.
-func initialize(config rlogConfig, reInitEnvVars bool) {
+// the supplied settings, which we need for our tests.
+func (core *loggerCore) initialize(config rlogConfig, reInitEnvVars bool) {
 	var err error
 
-	initMutex.Lock()
-	defer initMutex.Unlock()
+	core.initMutex.Lock()
+	defer core.initMutex.Unlock()
 
 	if reInitEnvVars {
-		configFromEnvVars = config
+		core.suppliedConfig = config
 	}
 
 	// Read and merge configuration from the config file
-	updateConfigFromFile(&config)
+	core.updateConfigFromFile(&config)
 
 	var checkTime int
 	checkTime, err = strconv.Atoi(config.confCheckInterv)
 	if err == nil {
-		settingCheckInterval = time.Duration(checkTime) * time.Second
+		core.settingCheckInterval = time.Duration(checkTime) * time.Second
 	} else {
 		if config.confCheckInterv != "" {
 			rlogIssue("Cannot parse config check interval value '%s'. Using default.",
 				config.confCheckInterv)
 		}
 	}
-	settingShowCallerInfo = isTrueBoolString(config.showCallerInfo)
-	settingShowGoroutineID = isTrueBoolString(config.showGoroutineID)
+	core.settingShowCallerInfo = isTrueBoolString(config.showCallerInfo)
+	core.settingShowGoroutineID = isTrueBoolString(config.showGoroutineID)
 
 	// initialize filters for trace (by default no trace output) and log levels
 	// (by default INFO level).
 	newTraceFilterSpec := new(filterSpec)
 	newTraceFilterSpec.fromString(config.traceLevel, true, noTraceOutput)
-	traceFilterSpec = newTraceFilterSpec
+	core.traceFilterSpec = newTraceFilterSpec
 
 	newLogFilterSpec := new(filterSpec)
 	newLogFilterSpec.fromString(config.logLevel, false, levelInfo)
-	logFilterSpec = newLogFilterSpec
+	core.logFilterSpec = newLogFilterSpec
 
 	// Evaluate the specified date/time format
-	settingDateTimeFormat = getTimeFormat(config)
+	core.settingDateTimeFormat = getTimeFormat(config)
+
+	// Evaluate the line format, plain text unless asked otherwise
+	switch config.logFormat {
+	case "", "TEXT":
+		core.settingLogFormat = "TEXT"
+	case "JSON", "LOGFMT":
+		core.settingLogFormat = config.logFormat
+	default:
+		rlogIssue("Unknown log format '%s'. Using TEXT.", config.logFormat)
+		core.settingLogFormat = "TEXT"
+	}
+
+	// Evaluate the log file rotation, none unless a maximum size is given
+	core.settingMaxSize = 0
+	if config.logMaxSize != "" {
+		if core.settingMaxSize, err = parseSize(config.logMaxSize); err != nil {
+			rlogIssue("Cannot parse log file maximum size '%s'. Not rotating.", config.logMaxSize)
+		}
+	}
+	core.settingMaxSegments = 0
+	if config.logMaxSegments != "" {
+		if core.settingMaxSegments, err = strconv.Atoi(config.logMaxSegments); err != nil || core.settingMaxSegments < 1 {
+			rlogIssue("Cannot parse log file segments value '%s'. Using default.", config.logMaxSegments)
+			core.settingMaxSegments = 0
+		}
+	}
+	core.settingCompress = isTrueBoolString(config.logCompress)
 
 	// By default we log to stderr...
 	// Evaluating whether a different log stream should be used.
@@ -472,29 +661,45 @@ func initialize(config rlogConfig, reInitEnvVars bool) {
 	// Note that in our log writers we disable date/time loggin, since we will
 	// take care of producing this ourselves.
 	if config.logStream == "STDOUT" {
-		logWriterStream = log.New(os.Stdout, "", 0)
+		core.logWriterStream = log.New(os.Stdout, "", 0)
 	} else if config.logStream == "NONE" {
-		logWriterStream = nil
+		core.logWriterStream = nil
 	} else {
-		logWriterStream = log.New(os.Stderr, "", 0)
+		core.logWriterStream = log.New(os.Stderr, "", 0)
+	}
+
+	/*
+	###########################################################################
+	##  Reopen the log file if it has been removed or renamed under us, even
+	##  though the name has not changed
+	##
+	##  Luke - 18th October 2026
+	##
+	###########################################################################
+	*/
+	if core.currentLogFileName != "" && core.currentLogFileName == config.logFile {
+		if _, err := os.Stat(core.currentLogFileName); err != nil {
+			core.currentLogFile.Close()
+			core.currentLogFileName = ""
+			core.logWriterFile = nil
+		}
 	}
 
 	// ... but if requested we'll also create and/or append to a logfile
-	var newLogFile *os.File
-	if currentLogFileName != config.logFile { // something changed
+	var newLogFile *rotatingFile
+	if core.currentLogFileName != config.logFile { // something changed
 		if config.logFile == "" {
 			// no more log output to a file
-			logWriterFile = nil
+			core.logWriterFile = nil
 		} else {
 			// Check if the logfile was changed or was set for the first
 			// time. Only then do we need to open/create a new file.
 			// We also do this if for some reason we don't have a log writer
 			// yet.
-			if currentLogFileName != config.logFile || logWriterFile == nil {
-				newLogFile, err = os.OpenFile(config.logFile,
-					os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if core.currentLogFileName != config.logFile || core.logWriterFile == nil {
+				newLogFile, err = openRotatingFile(config.logFile)
 				if err == nil {
-					logWriterFile = log.New(newLogFile, "", 0)
+					core.logWriterFile = log.New(newLogFile, "", 0)
 				} else {
 					rlogIssue("Unable to open log file: %s", err)
 					return
@@ -503,8 +708,8 @@ func initialize(config rlogConfig, reInitEnvVars bool) {
 		}
 
 		// Close the old logfile, since we are now writing to a new file
-		if currentLogFileName != "" {
-			currentLogFile.Close()
+		if core.currentLogFileName != "" {
+			core.currentLogFile.Close()
 		}
 
 		/*
@@ -517,16 +722,111 @@ func initialize(config rlogConfig, reInitEnvVars bool) {
 		###########################################################################
 		*/
 
-		currentLogFileName = config.logFile
-		currentLogFile = newLogFile
+		core.currentLogFileName = config.logFile
+		core.currentLogFile = newLogFile
+	}
+
+	// Rotation settings may change without the file changing
+	if core.currentLogFile != nil {
+		core.currentLogFile.setLimits(core.settingMaxSize, core.settingMaxSegments, core.settingCompress)
+	}
+}
+
+// initialize (re)configures the default logger. The tests use it directly.
+func initialize(config rlogConfig, reInitEnvVars bool) {
+	defaultLogger.core.initialize(config, reInitEnvVars)
+}
+
+// New returns a Logger configured by the given options. The environment
+// variables are not consulted.
+func New(opts Options) *Logger {
+	logger := &Logger{core: newCore()}
+	logger.SetOptions(opts)
+	return logger
+}
+
+// OptionsFromEnv returns the options given by the RLOG_* environment
+// variables, as used by the package level functions. This lets a program
+// start from the environment and adjust the options without changing it.
+func OptionsFromEnv() Options {
+	return optionsFromConfig(configFromEnv(), 0)
+}
+
+// Default returns the Logger used by the package level functions.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetOptions replaces the configuration of the Logger. Any config file given
+// in the options is read again.
+func (logger *Logger) SetOptions(opts Options) {
+	logger.core.initMutex.Lock()
+	logger.core.callerDepth = opts.CallerDepth
+	logger.core.initMutex.Unlock()
+	logger.core.initialize(configFromOptions(opts), true)
+}
+
+// Options returns the options the Logger was configured with, before any
+// values from the config file were merged in.
+func (logger *Logger) Options() Options {
+	logger.core.initMutex.RLock()
+	defer logger.core.initMutex.RUnlock()
+	return optionsFromConfig(logger.core.suppliedConfig, logger.core.callerDepth)
+}
+
+// WithFields returns a Logger which adds the given fields to every line it
+// logs, as well as any fields already attached to this Logger. The new Logger
+// shares its configuration and outputs with this one.
+func (logger *Logger) WithFields(fields Fields) *Logger {
+	newFields := make(Fields, len(logger.fields)+len(fields))
+	for key, value := range logger.fields {
+		newFields[key] = value
+	}
+	for key, value := range fields {
+		newFields[key] = value
 	}
+	return &Logger{core: logger.core, fields: newFields}
+}
+
+// Format returns the line format in use, TEXT, JSON or LOGFMT, after any
+// setting from the config file has been applied.
+func (logger *Logger) Format() string {
+	logger.core.initMutex.RLock()
+	defer logger.core.initMutex.RUnlock()
+	return logger.core.settingLogFormat
 }
 
 // SetConfFile enables the programmatic setting of a new config file path.
 // Any config values specified in that file will be immediately applied.
+func (logger *Logger) SetConfFile(confFileName string) {
+	logger.core.initMutex.RLock()
+	config := logger.core.suppliedConfig
+	logger.core.initMutex.RUnlock()
+	config.confFile = confFileName
+	logger.core.initialize(config, true)
+}
+
+// SetOutput re-wires the log output to a new io.Writer. By default rlog
+// logs to os.Stderr, but this function can be used to direct the output
+// somewhere else. If output to two destinations was specified then this will
+// change it back to just one output. Sinks added with AddSink are not
+// affected.
+func (logger *Logger) SetOutput(writer io.Writer) {
+	core := logger.core
+	core.initMutex.Lock()
+	defer core.initMutex.Unlock()
+	// Use the stored date/time flag settings
+	core.logWriterStream = log.New(writer, "", 0)
+	core.logWriterFile = nil
+	if core.currentLogFile != nil {
+		core.currentLogFile.Close()
+		core.currentLogFileName = ""
+	}
+}
+
+// SetConfFile sets the config file of the default logger.
 func SetConfFile(confFileName string) {
-	configFromEnvVars.confFile = confFileName
-	initialize(configFromEnvVars, false)
+	defaultLogger.SetConfFile(confFileName)
 }
 
 // UpdateEnv extracts settings for our logger from environment variables and
@@ -539,18 +839,15 @@ func UpdateEnv() {
 	initialize(config, true)
 }
 
-// SetOutput re-wires the log output to a new io.Writer. By default rlog
-// logs to os.Stderr, but this function can be used to direct the output
-// somewhere else. If output to two destinations was specified via environment
-// variables then this will change it back to just one output.
+// SetOutput re-wires the output of the default logger.
 func SetOutput(writer io.Writer) {
-	// Use the stored date/time flag settings
-	logWriterStream = log.New(writer, "", 0)
-	logWriterFile = nil
-	if currentLogFile != nil {
-		currentLogFile.Close()
-		currentLogFileName = ""
-	}
+	defaultLogger.SetOutput(writer)
+}
+
+// WithFields returns a Logger based on the default logger which adds the
+// given fields to every line.
+func WithFields(fields Fields) *Logger {
+	return defaultLogger.WithFields(fields)
 }
 
 // isTrueBoolString tests a string to see if it represents a 'true' value.
@@ -576,29 +873,137 @@ func rlogIssue(prefix string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, fmtStr, a...)
 }
 
+// formatFields renders fields as key=value pairs in key order, quoting any
+// value that would otherwise be ambiguous.
+func formatFields(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.WriteString(" ")
+		buf.WriteString(key)
+		buf.WriteString("=")
+		buf.WriteString(logfmtValue(fields[key]))
+	}
+	return buf.String()
+}
+
+// logfmtValue formats a single value for key=value output, quoting it if it
+// would otherwise be ambiguous.
+func logfmtValue(value interface{}) string {
+	valueString := fmt.Sprint(value)
+	if valueString == "" || strings.ContainsAny(valueString, " =\"\t\n") {
+		valueString = strconv.Quote(valueString)
+	}
+	return valueString
+}
+
+// jsonValue encodes a single value for JSON output. Anything which cannot be
+// encoded is logged as its string form instead.
+func jsonValue(value interface{}) []byte {
+	if err, isError := value.(error); isError {
+		value = err.Error()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return encoded
+}
+
+// structuredLine assembles a log record as a JSON object or logfmt line. The
+// standard keys come first, then the fields in key order. A field with the
+// same name as a standard key is given a "fields." prefix so nothing is lost.
+func structuredLine(logFormat string, record [][2]interface{}, fields Fields) string {
+	standardKeys := make(map[string]bool, len(record))
+	for _, pair := range record {
+		standardKeys[pair[0].(string)] = true
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		recordKey := key
+		if standardKeys[key] {
+			recordKey = "fields." + key
+		}
+		record = append(record, [2]interface{}{recordKey, fields[key]})
+	}
+
+	var buf bytes.Buffer
+	if logFormat == "JSON" {
+		buf.WriteString("{")
+		for i, pair := range record {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.Write(jsonValue(pair[0]))
+			buf.WriteString(":")
+			buf.Write(jsonValue(pair[1]))
+		}
+		buf.WriteString("}")
+	} else {
+		for i, pair := range record {
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			buf.WriteString(pair[0].(string))
+			buf.WriteString("=")
+			buf.WriteString(logfmtValue(pair[1]))
+		}
+	}
+	return buf.String()
+}
+
+// pairsToFields turns alternating keys and values into Fields. A key without
+// a value is kept with a placeholder so the mistake shows in the log.
+func pairsToFields(keysAndValues []interface{}) Fields {
+	fields := make(Fields, len(keysAndValues)/2+1)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 < len(keysAndValues) {
+			fields[key] = keysAndValues[i+1]
+		} else {
+			fields[key] = "(MISSING)"
+		}
+	}
+	return fields
+}
+
 // basicLog is called by all the 'level' log functions.
 // It checks what is configured to be included in the log message, decorates it
 // accordingly and assembles the entire line. It then uses the standard log
 // package to finally output the message.
-func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefixAddition string, a ...interface{}) {
+// The skip value is the number of stack frames between basicLog and the code
+// which called rlog, before any caller depth configured for wrappers.
+func (logger *Logger) basicLog(skip int, logLevel int, traceLevel int, isLocked bool, format string, prefixAddition string, a ...interface{}) {
 	now := time.Now()
+	core := logger.core
 
 	// In some cases the caller already got this lock for us
 	if !isLocked {
-		initMutex.RLock()
-		defer initMutex.RUnlock()
+		core.initMutex.RLock()
+		defer core.initMutex.RUnlock()
 	}
 
 	// Check if it's time to load updated information from the config file
-	if settingCheckInterval > 0 && now.Sub(lastConfigFileCheck) > settingCheckInterval {
+	if core.settingCheckInterval > 0 && now.Sub(core.lastConfigFileCheck) > core.settingCheckInterval {
 		// This unlock always happens, since initMutex is locked at this point,
 		// either by this function or the caller Initialize needs to be able to
-		initMutex.RUnlock()
+		core.initMutex.RUnlock()
 		// Get the full lock, so we need to release ours.
-		initialize(configFromEnvVars, false)
+		core.initialize(core.suppliedConfig, false)
 		// Take our reader lock again. This is fine, since only the check
 		// interval related items were read earlier.
-		initMutex.RLock()
+		core.initMutex.RLock()
 	}
 
 	// Extract information about the caller of the log function, if requested.
@@ -612,9 +1017,12 @@ func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefix
 	##
 	##  Original line -> pc, fullFilePath, line, ok := runtime.Caller(2)
 	##
+	##  The wrapper now says how deep it is with Options.CallerDepth
+	##  Luke - 18th October 2026
+	##
 	###########################################################################
 	*/
-	pc, fullFilePath, line, ok := runtime.Caller(3)
+	pc, fullFilePath, line, ok := runtime.Caller(skip + core.callerDepth)
 	if ok {
 		callingFuncName = runtime.FuncForPC(pc).Name()
 		// We only want to print or examine file and package name, so use the
@@ -630,24 +1038,114 @@ func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefix
 		moduleAndFileName = moduleName + "/" + fileName
 	}
 
-	// Perform tests to see if we should log this message.
+	// Perform tests to see if we should log this message. The stream and log
+	// file share the filters of the Logger, each sink has its own.
 	var allowLog bool
 	if traceLevel == notATrace {
-		if logFilterSpec.matchfilters(moduleAndFileName, logLevel) {
+		if core.logFilterSpec.matchfilters(moduleAndFileName, logLevel) {
 			allowLog = true
 		}
 	} else {
-		if traceFilterSpec.matchfilters(moduleAndFileName, traceLevel) {
+		if core.traceFilterSpec.matchfilters(moduleAndFileName, traceLevel) {
 			allowLog = true
 		}
 	}
-	if !allowLog {
+	var sinks []*sink
+	for _, s := range core.sinks {
+		if s.accepts(moduleAndFileName, logLevel, traceLevel) {
+			sinks = append(sinks, s)
+		}
+	}
+	if !allowLog && len(sinks) == 0 {
 		return
 	}
 
+	// Assemble the message
+	var msg string
+	if format != "" {
+		msg = fmt.Sprintf(format, a...)
+	} else {
+		msg = fmt.Sprintln(a...)
+	}
+
+	// Mask any secrets before the message goes anywhere
+	fields := logger.fields
+	if core.redactor != nil {
+		msg = core.redactor(msg)
+		fields = redactFields(fields, core.redactor)
+	}
+
+	// Each format in use is only assembled once
+	logLines := make(map[string]string, 1)
+	lineFor := func(logFormat string) string {
+		if logFormat == "" {
+			logFormat = core.settingLogFormat
+		}
+		logLine, ok := logLines[logFormat]
+		if !ok {
+			logLine = logger.formatLine(logFormat, now, logLevel, traceLevel, prefixAddition,
+				moduleAndFileName, line, callingFuncName, msg, fields)
+			logLines[logFormat] = logLine
+		}
+		return logLine
+	}
+
+	if allowLog {
+		if core.logWriterStream != nil {
+			core.logWriterStream.Print(lineFor(""))
+		}
+		if core.logWriterFile != nil {
+			core.logWriterFile.Print(lineFor(""))
+		}
+	}
+	for _, s := range sinks {
+		if s.recordWriter != nil {
+			// Errors are ignored, as they are for the other outputs
+			s.recordWriter.WriteRecord(Record{
+				Time:       now,
+				Level:      levelStrings[logLevel],
+				TraceLevel: traceLevel,
+				File:       moduleAndFileName,
+				Line:       line,
+				Func:       callingFuncName,
+				Msg:        strings.TrimSuffix(msg, "\n"),
+				Fields:     fields,
+			})
+			continue
+		}
+		s.writer.Print(lineFor(s.logFormat))
+	}
+}
+
+// formatLine assembles a log line in the given format.
+func (logger *Logger) formatLine(logFormat string, now time.Time, logLevel int, traceLevel int,
+	prefixAddition string, moduleAndFileName string, line int, callingFuncName string, msg string,
+	fields Fields) string {
+	core := logger.core
+
+	// Structured formats always carry the caller details as fields
+	if logFormat != "TEXT" {
+		var record [][2]interface{}
+		if core.settingDateTimeFormat != "" {
+			record = append(record, [2]interface{}{"time", now.Format(strings.TrimSuffix(core.settingDateTimeFormat, " "))})
+		}
+		record = append(record, [2]interface{}{"level", levelStrings[logLevel]})
+		if traceLevel != notATrace {
+			record = append(record, [2]interface{}{"trace", traceLevel})
+		}
+		record = append(record,
+			[2]interface{}{"pid", os.Getpid()},
+			[2]interface{}{"goroutine", getGID()},
+			[2]interface{}{"file", moduleAndFileName},
+			[2]interface{}{"line", line},
+			[2]interface{}{"func", callingFuncName},
+			[2]interface{}{"msg", strings.TrimSuffix(msg, "\n")})
+		return structuredLine(logFormat, record, fields)
+	}
+
 	callerInfo := ""
-	if settingShowCallerInfo {
-		if settingShowGoroutineID {
+	if core.settingShowCallerInfo {
+		if core.settingShowGoroutineID {
 			callerInfo = fmt.Sprintf("[%d:%d %s:%d (%s)] ", os.Getpid(),
 				getGID(), moduleAndFileName, line, callingFuncName)
 		} else {
@@ -657,21 +1155,12 @@ func basicLog(logLevel int, traceLevel int, isLocked bool, format string, prefix
 	}
 
 	// Assemble the actual log line
-	var msg string
-	if format != "" {
-		msg = fmt.Sprintf(format, a...)
-	} else {
-		msg = fmt.Sprintln(a...)
+	if len(fields) > 0 {
+		msg = strings.TrimSuffix(msg, "\n") + formatFields(fields)
 	}
 	levelDecoration := levelStrings[logLevel] + prefixAddition
-	logLine := fmt.Sprintf("%s%-9s: %s%s",
-		now.Format(settingDateTimeFormat), levelDecoration, callerInfo, msg)
-	if logWriterStream != nil {
-		logWriterStream.Print(logLine)
-	}
-	if logWriterFile != nil {
-		logWriterFile.Print(logLine)
-	}
+	return fmt.Sprintf("%s%-9s: %s%s",
+		now.Format(core.settingDateTimeFormat), levelDecoration, callerInfo, msg)
 }
 
 // getGID gets the current goroutine ID (algorithm from
@@ -686,60 +1175,167 @@ func getGID() uint64 {
 	return n
 }
 
+// trace is shared by the Trace functions and methods. There are possibly many
+// trace messages. If trace logging isn't enabled then we want to get out of
+// here as quickly as possible.
+func (logger *Logger) trace(skip int, traceLevel int, format string, a ...interface{}) {
+	logger.core.initMutex.RLock()
+	defer logger.core.initMutex.RUnlock()
+	if logger.core.traceEnabled() {
+		prefixAddition := fmt.Sprintf("(%d)", traceLevel)
+		logger.basicLog(skip+1, levelTrace, traceLevel, true, format, prefixAddition, a...)
+	}
+}
+
+// Trace is for low level tracing of activities. It takes an additional 'level'
+// parameter. The trace level setting is used to determine which levels of
+// trace message are output: Every message with a level lower or equal to
+// what is specified. If no trace level is set then no trace messages are
+// printed.
+func (logger *Logger) Trace(traceLevel int, a ...interface{}) {
+	logger.trace(2, traceLevel, "", a...)
+}
+
+// Tracef prints trace messages, with formatting.
+func (logger *Logger) Tracef(traceLevel int, format string, a ...interface{}) {
+	logger.trace(2, traceLevel, format, a...)
+}
+
+// Debug prints a message if the log level is set to DEBUG.
+func (logger *Logger) Debug(a ...interface{}) {
+	logger.basicLog(2, levelDebug, notATrace, false, "", "", a...)
+}
+
+// Debugf prints a message if the log level is set to DEBUG, with formatting.
+func (logger *Logger) Debugf(format string, a ...interface{}) {
+	logger.basicLog(2, levelDebug, notATrace, false, format, "", a...)
+}
+
+// Info prints a message if the log level is set to INFO or lower.
+func (logger *Logger) Info(a ...interface{}) {
+	logger.basicLog(2, levelInfo, notATrace, false, "", "", a...)
+}
+
+// Infof prints a message if the log level is set to INFO or lower, with
+// formatting.
+func (logger *Logger) Infof(format string, a ...interface{}) {
+	logger.basicLog(2, levelInfo, notATrace, false, format, "", a...)
+}
+
+// Println prints a message if the log level is set to INFO or lower.
+func (logger *Logger) Println(a ...interface{}) {
+	logger.basicLog(2, levelInfo, notATrace, false, "", "", a...)
+}
+
+// Printf prints a message if the log level is set to INFO or lower, with
+// formatting.
+func (logger *Logger) Printf(format string, a ...interface{}) {
+	logger.basicLog(2, levelInfo, notATrace, false, format, "", a...)
+}
+
+// Warn prints a message if the log level is set to WARN or lower.
+func (logger *Logger) Warn(a ...interface{}) {
+	logger.basicLog(2, levelWarn, notATrace, false, "", "", a...)
+}
+
+// Warnf prints a message if the log level is set to WARN or lower, with
+// formatting.
+func (logger *Logger) Warnf(format string, a ...interface{}) {
+	logger.basicLog(2, levelWarn, notATrace, false, format, "", a...)
+}
+
+// Error prints a message if the log level is set to ERROR or lower.
+func (logger *Logger) Error(a ...interface{}) {
+	logger.basicLog(2, levelErr, notATrace, false, "", "", a...)
+}
+
+// Errorf prints a message if the log level is set to ERROR or lower, with
+// formatting.
+func (logger *Logger) Errorf(format string, a ...interface{}) {
+	logger.basicLog(2, levelErr, notATrace, false, format, "", a...)
+}
+
+// Critical prints a message if the log level is set to CRITICAL or lower.
+func (logger *Logger) Critical(a ...interface{}) {
+	logger.basicLog(2, levelCrit, notATrace, false, "", "", a...)
+}
+
+// Criticalf prints a message if the log level is set to CRITICAL or lower,
+// with formatting.
+func (logger *Logger) Criticalf(format string, a ...interface{}) {
+	logger.basicLog(2, levelCrit, notATrace, false, format, "", a...)
+}
+
+// Debugw prints a message with key/value pairs if the log level is set to
+// DEBUG. The pairs are added as fields, e.g. Debugw("msg", "key", value).
+func (logger *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	logger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelDebug, notATrace, false, "%s", "", msg)
+}
+
+// Infow prints a message with key/value pairs if the log level is set to INFO
+// or lower.
+func (logger *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	logger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelInfo, notATrace, false, "%s", "", msg)
+}
+
+// Warnw prints a message with key/value pairs if the log level is set to WARN
+// or lower.
+func (logger *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	logger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelWarn, notATrace, false, "%s", "", msg)
+}
+
+// Errorw prints a message with key/value pairs if the log level is set to
+// ERROR or lower.
+func (logger *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	logger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelErr, notATrace, false, "%s", "", msg)
+}
+
+// Criticalw prints a message with key/value pairs if the log level is set to
+// CRITICAL or lower.
+func (logger *Logger) Criticalw(msg string, keysAndValues ...interface{}) {
+	logger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelCrit, notATrace, false, "%s", "", msg)
+}
+
 // Trace is for low level tracing of activities. It takes an additional 'level'
 // parameter. The RLOG_TRACE_LEVEL variable is used to determine which levels
 // of trace message are output: Every message with a level lower or equal to
 // what is specified in RLOG_TRACE_LEVEL. If RLOG_TRACE_LEVEL is not defined at
 // all then no trace messages are printed.
 func Trace(traceLevel int, a ...interface{}) {
-	// There are possibly many trace messages. If trace logging isn't enabled
-	// then we want to get out of here as quickly as possible.
-	initMutex.RLock()
-	defer initMutex.RUnlock()
-	if len(traceFilterSpec.filters) > 0 {
-		prefixAddition := fmt.Sprintf("(%d)", traceLevel)
-		basicLog(levelTrace, traceLevel, true, "", prefixAddition, a...)
-	}
+	defaultLogger.trace(2, traceLevel, "", a...)
 }
 
 // Tracef prints trace messages, with formatting.
 func Tracef(traceLevel int, format string, a ...interface{}) {
-	// There are possibly many trace messages. If trace logging isn't enabled
-	// then we want to get out of here as quickly as possible.
-	initMutex.RLock()
-	defer initMutex.RUnlock()
-	if len(traceFilterSpec.filters) > 0 {
-		prefixAddition := fmt.Sprintf("(%d)", traceLevel)
-		basicLog(levelTrace, traceLevel, true, format, prefixAddition, a...)
-	}
+	defaultLogger.trace(2, traceLevel, format, a...)
 }
 
 // Debug prints a message if RLOG_LEVEL is set to DEBUG.
 func Debug(a ...interface{}) {
-	basicLog(levelDebug, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelDebug, notATrace, false, "", "", a...)
 }
 
 // Debugf prints a message if RLOG_LEVEL is set to DEBUG, with formatting.
 func Debugf(format string, a ...interface{}) {
-	basicLog(levelDebug, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelDebug, notATrace, false, format, "", a...)
 }
 
 // Info prints a message if RLOG_LEVEL is set to INFO or lower.
 func Info(a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelInfo, notATrace, false, "", "", a...)
 }
 
 // Infof prints a message if RLOG_LEVEL is set to INFO or lower, with
 // formatting.
 func Infof(format string, a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelInfo, notATrace, false, format, "", a...)
 }
 
 // Println prints a message if RLOG_LEVEL is set to INFO or lower.
 // Println shouldn't be used except for backward compatibility
 // with standard log package, directly using Info is preferred way.
 func Println(a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelInfo, notATrace, false, "", "", a...)
 }
 
 // Printf prints a message if RLOG_LEVEL is set to INFO or lower, with
@@ -747,40 +1343,69 @@ func Println(a ...interface{}) {
 // Printf shouldn't be used except for backward compatibility
 // with standard log package, directly using Infof is preferred way.
 func Printf(format string, a ...interface{}) {
-	basicLog(levelInfo, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelInfo, notATrace, false, format, "", a...)
 }
 
 // Warn prints a message if RLOG_LEVEL is set to WARN or lower.
 func Warn(a ...interface{}) {
-	basicLog(levelWarn, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelWarn, notATrace, false, "", "", a...)
 }
 
 // Warnf prints a message if RLOG_LEVEL is set to WARN or lower, with
 // formatting.
 func Warnf(format string, a ...interface{}) {
-	basicLog(levelWarn, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelWarn, notATrace, false, format, "", a...)
 }
 
 // Error prints a message if RLOG_LEVEL is set to ERROR or lower.
 func Error(a ...interface{}) {
-	basicLog(levelErr, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelErr, notATrace, false, "", "", a...)
 }
 
 // Errorf prints a message if RLOG_LEVEL is set to ERROR or lower, with
 // formatting.
 func Errorf(format string, a ...interface{}) {
-	basicLog(levelErr, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelErr, notATrace, false, format, "", a...)
 }
 
 // Critical prints a message if RLOG_LEVEL is set to CRITICAL or lower.
 func Critical(a ...interface{}) {
-	basicLog(levelCrit, notATrace, false, "", "", a...)
+	defaultLogger.basicLog(2, levelCrit, notATrace, false, "", "", a...)
 }
 
 // Criticalf prints a message if RLOG_LEVEL is set to CRITICAL or lower, with
 // formatting.
 func Criticalf(format string, a ...interface{}) {
-	basicLog(levelCrit, notATrace, false, format, "", a...)
+	defaultLogger.basicLog(2, levelCrit, notATrace, false, format, "", a...)
+}
+
+// Debugw prints a message with key/value pairs if RLOG_LEVEL is set to DEBUG.
+func Debugw(msg string, keysAndValues ...interface{}) {
+	defaultLogger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelDebug, notATrace, false, "%s", "", msg)
+}
+
+// Infow prints a message with key/value pairs if RLOG_LEVEL is set to INFO or
+// lower.
+func Infow(msg string, keysAndValues ...interface{}) {
+	defaultLogger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelInfo, notATrace, false, "%s", "", msg)
+}
+
+// Warnw prints a message with key/value pairs if RLOG_LEVEL is set to WARN or
+// lower.
+func Warnw(msg string, keysAndValues ...interface{}) {
+	defaultLogger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelWarn, notATrace, false, "%s", "", msg)
+}
+
+// Errorw prints a message with key/value pairs if RLOG_LEVEL is set to ERROR
+// or lower.
+func Errorw(msg string, keysAndValues ...interface{}) {
+	defaultLogger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelErr, notATrace, false, "%s", "", msg)
+}
+
+// Criticalw prints a message with key/value pairs if RLOG_LEVEL is set to
+// CRITICAL or lower.
+func Criticalw(msg string, keysAndValues ...interface{}) {
+	defaultLogger.WithFields(pairsToFields(keysAndValues)).basicLog(2, levelCrit, notATrace, false, "%s", "", msg)
 }
 
 /*
@@ -794,7 +1419,7 @@ func Criticalf(format string, a ...interface{}) {
 */
 
 // Checking whether current level at at or less than level input
-func CheckLevel(levelToken string) (bool) {
+func (logger *Logger) CheckLevel(levelToken string) (bool) {
 	var allowLog      bool
 
 	filterLevel, ok := levelNumbers[levelToken]
@@ -802,12 +1427,20 @@ func CheckLevel(levelToken string) (bool) {
 		rlogIssue("Illegal log level string '%s'.", levelToken)
 	} 
 
-	traceLevelInt, _ := strconv.Atoi(configFromEnvVars.traceLevel)
+	logger.core.initMutex.RLock()
+	defer logger.core.initMutex.RUnlock()
+
+	traceLevelInt, _ := strconv.Atoi(logger.core.suppliedConfig.traceLevel)
 	if traceLevelInt > 0 {
 		allowLog=true
 	} else {
-		allowLog=logFilterSpec.matchfilters("", filterLevel)
+		allowLog=logger.core.logFilterSpec.matchfilters("", filterLevel)
 	}
 
 	return allowLog
 }
+
+// CheckLevel checks the level of the default logger.
+func CheckLevel(levelToken string) (bool) {
+	return defaultLogger.CheckLevel(levelToken)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+/*
+###########################################################################
+##  Added size based rotation of the log file, keeping a number of older
+##  segments which may be compressed, for long or verbose runs
+##
+##  Luke - 18th October 2026
+##
+###########################################################################
+*/
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultMaxSegments is the number of rotated segments kept when a maximum
+// size is set without a number of segments.
+const defaultMaxSegments = 5
+
+// defaultFileMode is used for a new log file. Files made by rotation keep the
+// mode of the file they replace.
+const defaultFileMode os.FileMode = 0640
+
+// rotatingFile is the log file. Once a write would take it past maxSize it is
+// renamed to <name>.1, older segments move up one (<name>.2 and so on) and
+// a new file is started. Segments beyond maxSegments are removed. With
+// compress set the rotated segment is gzipped to <name>.1.gz.
+type rotatingFile struct {
+	mutex       sync.Mutex
+	file        *os.File
+	name        string
+	size        int64
+	maxSize     int64
+	maxSegments int
+	compress    bool
+}
+
+// openRotatingFile opens or creates the log file for appending.
+func openRotatingFile(name string) (*rotatingFile, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, defaultFileMode)
+	if err != nil {
+		return nil, err
+	}
+	rf := &rotatingFile{file: file, name: name}
+	if info, err := file.Stat(); err == nil {
+		rf.size = info.Size()
+	}
+	return rf, nil
+}
+
+// setLimits changes the rotation settings. A maxSize of 0 turns rotation off.
+func (rf *rotatingFile) setLimits(maxSize int64, maxSegments int, compress bool) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if maxSegments <= 0 {
+		maxSegments = defaultMaxSegments
+	}
+	rf.maxSize = maxSize
+	rf.maxSegments = maxSegments
+	rf.compress = compress
+}
+
+// Write appends to the file, rotating first if the file would become too
+// large. A line is never split between segments.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			rlogIssue("Unable to rotate log file %s: %s", rf.name, err)
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (rf *rotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	return rf.file.Close()
+}
+
+// segmentName returns the name of a rotated segment, without any .gz.
+func (rf *rotatingFile) segmentName(segment int) string {
+	return rf.name + "." + strconv.Itoa(segment)
+}
+
+// rotate moves the current file to the first segment and starts a new one.
+// The caller holds the mutex.
+func (rf *rotatingFile) rotate() error {
+	// Make room by dropping the oldest segment and moving the rest up
+	oldest := rf.segmentName(rf.maxSegments)
+	os.Remove(oldest)
+	os.Remove(oldest + ".gz")
+	for segment := rf.maxSegments - 1; segment >= 1; segment-- {
+		for _, suffix := range []string{"", ".gz"} {
+			from := rf.segmentName(segment) + suffix
+			if _, err := os.Stat(from); err == nil {
+				if err := os.Rename(from, rf.segmentName(segment+1)+suffix); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := os.Rename(rf.name, rf.segmentName(1)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rf.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, fileMode(rf.segmentName(1)))
+	if err != nil {
+		// Carry on writing to the renamed file rather than losing output
+		return err
+	}
+	rf.file.Close()
+	rf.file = file
+	rf.size = 0
+
+	if rf.compress {
+		return compressFile(rf.segmentName(1))
+	}
+	return nil
+}
+
+// fileMode returns the permissions of an existing file or the default.
+func fileMode(name string) os.FileMode {
+	if info, err := os.Stat(name); err == nil {
+		return info.Mode().Perm()
+	}
+	return defaultFileMode
+}
+
+// compressFile gzips a file to <name>.gz and removes the original.
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode(name))
+	if err != nil {
+		return err
+	}
+	zipper := gzip.NewWriter(out)
+	if _, err = io.Copy(zipper, in); err == nil {
+		err = zipper.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
+
+// parseSize reads a size in bytes with an optional K, M or G suffix.
+func parseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(size, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(size, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(size, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return value * multiplier, nil
+}
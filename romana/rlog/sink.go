@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+/*
+###########################################################################
+##  Added sinks so a Logger can write to any number of outputs, each with
+##  its own level filters and format, alongside the stream and log file
+##
+##  Luke - 18th October 2026
+##
+###########################################################################
+*/
+
+import (
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SinkOptions configures an output added to a Logger with AddSink. The level
+// strings take the same form as RLOG_LOG_LEVEL and RLOG_TRACE_LEVEL.
+type SinkOptions struct {
+	LogLevel   string // Empty means INFO
+	TraceLevel string // Empty means no trace output
+	LogFormat  string // TEXT, JSON or LOGFMT. Empty means the format of the Logger
+}
+
+// Record holds the parts of a log message for writers which do their own
+// formatting, such as the syslog and journal writers.
+type Record struct {
+	Time       time.Time
+	Level      string // TRACE, DEBUG, INFO, WARN, ERROR or CRITICAL
+	TraceLevel int    // Trace level of trace messages, otherwise -1
+	File       string // Module and file name of the caller
+	Line       int
+	Func       string
+	Msg        string
+	Fields     Fields
+}
+
+// RecordWriter is implemented by sink writers which take the parts of each
+// message instead of a formatted line. The format of the sink is then unused.
+type RecordWriter interface {
+	WriteRecord(record Record) error
+}
+
+// sink is an extra output of a Logger with its own filters and format.
+type sink struct {
+	name         string
+	writer       *log.Logger
+	recordWriter RecordWriter
+	logFilter    *filterSpec
+	traceFilter  *filterSpec
+	logFormat    string
+}
+
+// accepts checks the filters of the sink against a message.
+func (s *sink) accepts(moduleAndFileName string, logLevel int, traceLevel int) bool {
+	if traceLevel == notATrace {
+		return s.logFilter.matchfilters(moduleAndFileName, logLevel)
+	}
+	return s.traceFilter.matchfilters(moduleAndFileName, traceLevel)
+}
+
+// traceEnabled checks whether trace output is wanted by the Logger or by any
+// of its sinks. The caller holds initMutex.
+func (core *loggerCore) traceEnabled() bool {
+	if len(core.traceFilterSpec.filters) > 0 {
+		return true
+	}
+	for _, s := range core.sinks {
+		if len(s.traceFilter.filters) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSink adds an output to the Logger, or replaces the output with the same
+// name. The sink stays in place when the Logger is reconfigured and is shared
+// with Loggers derived using WithFields. The caller keeps ownership of the
+// writer and closes it, if needed, after removing the sink.
+func (logger *Logger) AddSink(name string, writer io.Writer, opts SinkOptions) {
+	newSink := &sink{
+		name:        name,
+		writer:      log.New(writer, "", 0),
+		logFilter:   new(filterSpec),
+		traceFilter: new(filterSpec),
+		logFormat:   strings.ToUpper(opts.LogFormat),
+	}
+	if recordWriter, ok := writer.(RecordWriter); ok {
+		newSink.recordWriter = recordWriter
+	}
+	newSink.logFilter.fromString(opts.LogLevel, false, levelInfo)
+	newSink.traceFilter.fromString(opts.TraceLevel, true, noTraceOutput)
+
+	switch newSink.logFormat {
+	case "", "TEXT", "JSON", "LOGFMT":
+	default:
+		rlogIssue("Unknown log format '%s' for sink %s. Using TEXT.", opts.LogFormat, name)
+		newSink.logFormat = "TEXT"
+	}
+
+	core := logger.core
+	core.initMutex.Lock()
+	defer core.initMutex.Unlock()
+
+	for i, existing := range core.sinks {
+		if existing.name == name {
+			core.sinks[i] = newSink
+			return
+		}
+	}
+	core.sinks = append(core.sinks, newSink)
+}
+
+// RemoveSink removes the named output from the Logger. Removing a sink which
+// does not exist does nothing.
+func (logger *Logger) RemoveSink(name string) {
+	core := logger.core
+	core.initMutex.Lock()
+	defer core.initMutex.Unlock()
+
+	for i, existing := range core.sinks {
+		if existing.name == name {
+			core.sinks = append(core.sinks[:i], core.sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Sinks returns the names of the outputs added to the Logger, in the order
+// they were added.
+func (logger *Logger) Sinks() []string {
+	core := logger.core
+	core.initMutex.RLock()
+	defer core.initMutex.RUnlock()
+
+	names := make([]string, 0, len(core.sinks))
+	for _, existing := range core.sinks {
+		names = append(names, existing.name)
+	}
+	return names
+}
+
+// AddSink adds an output to the default logger.
+func AddSink(name string, writer io.Writer, opts SinkOptions) {
+	defaultLogger.AddSink(name, writer, opts)
+}
+
+// RemoveSink removes an output from the default logger.
+func RemoveSink(name string) {
+	defaultLogger.RemoveSink(name)
+}
+
+// RingBuffer is a writer which keeps the most recent log lines in memory,
+// for example to include in an alert or to show in a status page.
+type RingBuffer struct {
+	mutex sync.Mutex
+	lines []string
+	next  int
+	count int
+}
+
+// NewRingBuffer returns a RingBuffer holding up to size lines.
+func NewRingBuffer(size int) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBuffer{lines: make([]string, size)}
+}
+
+// Write stores one log line, dropping the oldest line if the buffer is full.
+func (ring *RingBuffer) Write(p []byte) (int, error) {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	ring.lines[ring.next] = strings.TrimSuffix(string(p), "\n")
+	ring.next = (ring.next + 1) % len(ring.lines)
+	if ring.count < len(ring.lines) {
+		ring.count++
+	}
+	return len(p), nil
+}
+
+// Lines returns the stored lines, oldest first.
+func (ring *RingBuffer) Lines() []string {
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	lines := make([]string, 0, ring.count)
+	start := (ring.next - ring.count + len(ring.lines)) % len(ring.lines)
+	for i := 0; i < ring.count; i++ {
+		lines = append(lines, ring.lines[(start+i)%len(ring.lines)])
+	}
+	return lines
+}
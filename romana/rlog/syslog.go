@@ -0,0 +1,277 @@
+// Copyright (c) 2016 Pani Networks
+// All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package rlog
+
+/*
+###########################################################################
+##  Added syslog (RFC 5424) and systemd journal writers for use as sinks
+##  so runs can be picked up by central log collection
+##
+##  Luke - 18th October 2026
+##
+###########################################################################
+*/
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSyslogAddress is the local syslog socket.
+const DefaultSyslogAddress = "unix:/dev/log"
+
+// sdID names the structured data element of syslog messages. 32473 is the
+// enterprise number reserved for examples and private use.
+const sdID = "fields@32473"
+
+var syslogFacilities = map[string]int{
+	"KERN":     0,
+	"USER":     1,
+	"MAIL":     2,
+	"DAEMON":   3,
+	"AUTH":     4,
+	"SYSLOG":   5,
+	"LPR":      6,
+	"NEWS":     7,
+	"UUCP":     8,
+	"CRON":     9,
+	"AUTHPRIV": 10,
+	"FTP":      11,
+	"LOCAL0":   16,
+	"LOCAL1":   17,
+	"LOCAL2":   18,
+	"LOCAL3":   19,
+	"LOCAL4":   20,
+	"LOCAL5":   21,
+	"LOCAL6":   22,
+	"LOCAL7":   23,
+}
+
+// syslogSeverity maps an rlog level to a syslog severity.
+func syslogSeverity(level string) int {
+	switch level {
+	case "CRITICAL":
+		return 2
+	case "ERROR":
+		return 3
+	case "WARN":
+		return 4
+	case "INFO":
+		return 6
+	}
+	return 7
+}
+
+// recordFields holds fields which a writer adds to every record, such as the
+// database a program is working on.
+type recordFields struct {
+	fieldsMutex sync.Mutex
+	fields      Fields
+}
+
+// SetFields replaces the fields added to every record.
+func (rf *recordFields) SetFields(fields Fields) {
+	copied := make(Fields, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	rf.fieldsMutex.Lock()
+	rf.fields = copied
+	rf.fieldsMutex.Unlock()
+}
+
+// merged returns the writer fields with the record fields on top, keyed by
+// their upper case names in sorted order.
+func (rf *recordFields) merged(fields Fields) ([]string, map[string]string) {
+	values := make(map[string]string)
+	rf.fieldsMutex.Lock()
+	for key, value := range rf.fields {
+		values[upperFieldName(key)] = fmt.Sprint(value)
+	}
+	rf.fieldsMutex.Unlock()
+	for key, value := range fields {
+		values[upperFieldName(key)] = fmt.Sprint(value)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, values
+}
+
+// upperFieldName turns a field name into one that suits both syslog parameter
+// names and journal field names: upper case letters, digits and underscores,
+// starting with a letter and at most 32 characters.
+func upperFieldName(name string) string {
+	upper := []byte(strings.ToUpper(name))
+	for i, c := range upper {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			upper[i] = '_'
+		}
+	}
+	if len(upper) == 0 || upper[0] < 'A' || upper[0] > 'Z' {
+		upper = append([]byte("F"), upper...)
+	}
+	if len(upper) > 32 {
+		upper = upper[:32]
+	}
+	return string(upper)
+}
+
+// appName returns the name of the running program.
+func appName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// SyslogWriter sends records to syslog in RFC 5424 format, with the fields as
+// structured data. Use it as a sink with AddSink.
+type SyslogWriter struct {
+	recordFields
+	mutex    sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	facility int
+	hostName string
+	appName  string
+}
+
+// NewSyslogWriter connects to syslog. The address is either unix:/path for a
+// local datagram socket or host:port for UDP. An empty address means
+// DefaultSyslogAddress, an empty facility USER and an empty name the program
+// name.
+func NewSyslogWriter(address string, facility string, name string) (*SyslogWriter, error) {
+	if address == "" {
+		address = DefaultSyslogAddress
+	}
+	if facility == "" {
+		facility = "USER"
+	}
+	if name == "" {
+		name = appName()
+	}
+	facilityCode, ok := syslogFacilities[strings.ToUpper(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %s", facility)
+	}
+
+	writer := &SyslogWriter{
+		network:  "udp",
+		address:  address,
+		facility: facilityCode,
+		appName:  name,
+	}
+	if strings.HasPrefix(address, "unix:") {
+		writer.network = "unixgram"
+		writer.address = strings.TrimPrefix(address, "unix:")
+	}
+	writer.hostName, _ = os.Hostname()
+	if writer.hostName == "" {
+		writer.hostName = "-"
+	}
+
+	if err := writer.connect(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// connect (re)opens the connection. The caller holds the mutex or has the
+// only reference.
+func (writer *SyslogWriter) connect() error {
+	if writer.conn != nil {
+		writer.conn.Close()
+		writer.conn = nil
+	}
+	conn, err := net.Dial(writer.network, writer.address)
+	if err != nil {
+		return err
+	}
+	writer.conn = conn
+	return nil
+}
+
+// WriteRecord sends one record.
+func (writer *SyslogWriter) WriteRecord(record Record) error {
+	names, values := writer.merged(record.Fields)
+	structuredData := "-"
+	if len(names) > 0 {
+		var sd strings.Builder
+		sd.WriteString("[" + sdID)
+		for _, name := range names {
+			sd.WriteString(" " + name + "=\"" + sdEscaper.Replace(values[name]) + "\"")
+		}
+		sd.WriteString("]")
+		structuredData = sd.String()
+	}
+
+	message := fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		writer.facility*8+syslogSeverity(record.Level),
+		record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		writer.hostName, writer.appName, os.Getpid(), structuredData, record.Msg)
+
+	return writer.send([]byte(message))
+}
+
+// Write sends a formatted line at INFO severity, for use as a plain writer.
+func (writer *SyslogWriter) Write(p []byte) (int, error) {
+	err := writer.WriteRecord(Record{Time: time.Now(), Level: "INFO", TraceLevel: notATrace,
+		Msg: strings.TrimSuffix(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send writes a message, reconnecting once in case syslog was restarted.
+func (writer *SyslogWriter) send(message []byte) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.conn != nil {
+		if _, err := writer.conn.Write(message); err == nil {
+			return nil
+		}
+	}
+	if err := writer.connect(); err != nil {
+		return err
+	}
+	_, err := writer.conn.Write(message)
+	return err
+}
+
+// Close closes the connection.
+func (writer *SyslogWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.conn == nil {
+		return nil
+	}
+	err := writer.conn.Close()
+	writer.conn = nil
+	return err
+}
+
+// sdEscaper escapes structured data parameter values as RFC 5424 requires.
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
@@ -6,11 +6,14 @@ import "bufio"
 import "flag"
 import "os"
 import "path/filepath"
+import "strconv"
 import "strings"
+import "time"
 
 // local imports
 
 import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
 import "github.com/daviesluke/utils"
 
 // Global variables
@@ -21,16 +24,52 @@ var ConfigValues = map[string]string {
 	"LogKeepTime"       : "14",
 	"NLS_DATE_FORMAT"   : "DD_MON_YYYY HH24:MI:SS",
 	"OraTabPath"        : "/etc/oratab:/var/opt/oracle/oratab",
+	"EnvFile"           : "",
+	"TnsAdmin"          : "",
+	"CatalogRegister"   : "Y",
+	"CatalogResync"     : "Y",
+	"CatalogMaxLag"     : "24",
 	"RMANConfig"        : "",
 	"CatalogConnection" : "",
 	"TargetConnection"  : "/",
 	"CheckLockMins"     : "5",
 	"CheckResourceMins" : "5",
+	"CheckLockTimeout"  : "",
+	"CheckResourceTimeout" : "",
+	"PollInterval"      : "5s",
+	"PollMaxInterval"   : "60s",
 	"ParallelSlaves"    : "1",
 	"ChannelDevice"     : "DISK",
 	"FileFormat"        : "",
 	"RMANIgnoreCodes"   : "",
 	"EmailServer"       : "localhost:25",
+	"StderrLogLevel"    : "",
+	"SyslogLogLevel"    : "",
+	"SyslogAddress"     : "unix:/dev/log",
+	"SyslogFacility"    : "USER",
+	"JournalLogLevel"   : "",
+	"RedactPatterns"    : "",
+	"SlowRunFactor"     : "3",
+	"SlowRunMinRuns"    : "5",
+	"SlowRunHistory"    : "20",
+	"MetricsDir"        : "",
+	"PreflightChecks"   : "",
+	"FRAMaxPercent"     : "90",
+	"OpenModes"         : "READ WRITE",
+	"StandbyOpenModes"  : "MOUNTED;READ ONLY;READ ONLY WITH APPLY",
+	"BackupOn"          : "ANY",
+	"ReportLevel0Age"   : "8",
+	"ReportLevel1Age"   : "2",
+	"ReportArchivelogAge" : "1",
+	"ReportDatafileAge" : "8",
+	"ReportRecoveryWindow" : "",
+	"ValidateDays"      : "7",
+	"ValidateControlfile" : "N",
+	"FleetConcurrency"  : "1",
+	"SharedLockDir"     : "",
+	"LeaseSecs"         : "300",
+	"CoordinatorAddress": "",
+	"PartialResources"  : "N",
 }
 
 var ConfigFileValues      map[string]string
@@ -38,6 +77,12 @@ var ConfigFileValues      map[string]string
 var RMANScript        string
 var RMANScriptBase    string
 
+// Config names that may be set per script as well as per database
+
+var scriptConfigNames = map[string]bool{
+	"BackupOn" : true,
+}
+
 // Global Functions
 
 func GetConfig ( configFileName string ) {
@@ -102,6 +147,12 @@ func GetConfig ( configFileName string ) {
 			ConfigFileValues[strings.TrimSpace(variableTokens[0])]=strings.TrimSpace(variableTokens[1])
 			logger.Tracef("Set map key %s", strings.TrimSpace(variableTokens[0]))
 
+			// Mask with any extra patterns straight away so later lines are covered
+
+			if strings.TrimSpace(variableTokens[0]) == "RedactPatterns" {
+				logger.SetRedactPatterns(ConfigFileValues["RedactPatterns"])
+			}
+
 
 			//
 			// If variable ends with Connection then careful with printing passwords
@@ -179,6 +230,19 @@ func SetRMANScript () {
 	logger.Debug("Process complete")
 }
 
+func SetValidateScript () {
+	logger.Debug("Setting the restore validation script ...")
+
+	// Generated later once the config is read.  The base name is validate so it has its own history
+
+	RMANScript     = filepath.Join(setup.TmpDir, strings.Join( []string{ "validate", setup.CurrentPID, "rcv" }, "."))
+	RMANScriptBase = "validate"
+
+	logger.Infof("RMAN script to run -> %s (generated)", RMANScript)
+
+	logger.Debug("Process complete")
+}
+
 func SetConfig ( database string , configName string ) {
 	logger.Debugf("Checking and setting config entry %s for database %s ...", configName, database)
 
@@ -188,25 +252,41 @@ func SetConfig ( database string , configName string ) {
 
 	isConnection := utils.CheckRegEx(configName,".+Connection$")
 
-	newConfigName := strings.Join( []string{ database, configName}, "_")
+	// Most specific first - database then the plain name
+	// Only the backup role may also be set per script - database and script, script, database then the plain name
 
-	logger.Tracef("New config name set to %s", newConfigName)
-	
-	if _, keyExists := ConfigFileValues[newConfigName]; keyExists {
-		ConfigValues[configName] = ConfigFileValues[newConfigName]
-		if isConnection {
-			logger.Infof("Found config name %s in config file. Reset config name %s to %s", newConfigName, configName, utils.RemovePassword(ConfigValues[configName],false))
-		} else {
-			logger.Infof("Found config name %s in config file. Reset config name %s to %s", newConfigName, configName, ConfigValues[configName])
-		}
-	} else if _, keyExists := ConfigFileValues[configName]; keyExists {
-		ConfigValues[configName] = ConfigFileValues[configName]
-		if isConnection {
-			logger.Infof("Found config name %s in config file. Reset config name %s to %s", configName, configName, utils.RemovePassword(ConfigValues[configName],false))
-		} else {
-			logger.Infof("Found config name %s in config file. Reset config name %s to %s", configName, configName, ConfigValues[configName])
+	var newConfigNames []string
+
+	if RMANScriptBase != "" && scriptConfigNames[configName] {
+		newConfigNames = []string{
+			strings.Join( []string{ database, RMANScriptBase, configName}, "_"),
+			strings.Join( []string{ RMANScriptBase, configName}, "_"),
+			strings.Join( []string{ database, configName}, "_"),
+			configName,
 		}
 	} else {
+		newConfigNames = []string{ strings.Join( []string{ database, configName}, "_"), configName }
+	}
+
+	logger.Tracef("New config names set to %v", newConfigNames)
+
+	found := false
+
+	for _, newConfigName := range newConfigNames {
+		if _, keyExists := ConfigFileValues[newConfigName]; keyExists {
+			ConfigValues[configName] = ConfigFileValues[newConfigName]
+			if isConnection {
+				logger.Infof("Found config name %s in config file. Reset config name %s to %s", newConfigName, configName, utils.RemovePassword(ConfigValues[configName],false))
+			} else {
+				logger.Infof("Found config name %s in config file. Reset config name %s to %s", newConfigName, configName, ConfigValues[configName])
+			}
+
+			found = true
+			break
+		}
+	}
+
+	if ! found {
 		logger.Infof("No changes made from default name for %s - Value %s", configName, ConfigValues[configName])
 	}
 
@@ -222,5 +302,51 @@ func SetAllConfig ( database string ) {
 
 	logger.SetEmailServer(ConfigValues["EmailServer"])
 
+	logger.SetStderrLevel(ConfigValues["StderrLogLevel"])
+
+	logger.SetSyslog(ConfigValues["SyslogLogLevel"], ConfigValues["SyslogAddress"], ConfigValues["SyslogFacility"])
+
+	logger.SetJournal(ConfigValues["JournalLogLevel"])
+
+	logger.SetRedactPatterns(ConfigValues["RedactPatterns"])
+
+	if ConfigValues["SharedLockDir"] != "" {
+		setup.SetSharedDir(ConfigValues["SharedLockDir"])
+	}
+
 	logger.Info("Process complete")
 }
+
+func GetDuration ( configName string, defaultUnit time.Duration ) time.Duration {
+	logger.Debugf("Getting duration for config entry %s ...", configName)
+
+	configValue := strings.TrimSpace(ConfigValues[configName])
+
+	// Plain numbers are in the default unit so older settings such as CheckLockMins=5 still work
+
+	if configNumber, err := strconv.Atoi(configValue); err == nil {
+		logger.Debugf("Duration set to %s", time.Duration(configNumber) * defaultUnit)
+		return time.Duration(configNumber) * defaultUnit
+	}
+
+	configDuration, err := time.ParseDuration(configValue)
+	if err != nil || configDuration < 0 {
+		logger.Errorf("Invalid duration %s for config entry %s. Use a number or a duration such as 30s or 2h", configValue, configName)
+	}
+
+	logger.Debugf("Duration set to %s", configDuration)
+
+	return configDuration
+}
+
+func GetTimeout ( timeoutName string, minsName string ) time.Duration {
+	logger.Debugf("Getting timeout from %s or %s ...", timeoutName, minsName)
+
+	// The duration setting wins if given otherwise fall back to the older minutes setting
+
+	if strings.TrimSpace(ConfigValues[timeoutName]) != "" {
+		return GetDuration(timeoutName, time.Second)
+	}
+
+	return GetDuration(minsName, time.Minute)
+}
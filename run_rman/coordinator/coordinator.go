@@ -0,0 +1,594 @@
+package coordinator
+
+// Standard imports
+
+import "bufio"
+import "fmt"
+import "net"
+import "os"
+import "sort"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/run_rman/config"
+
+// local Variables
+
+//
+// Daemon side - one client per connected run_rman process
+// Anything a client holds is released when its connection goes away
+//
+
+type client struct {
+	pid       string
+	host      string
+	priority  int
+	locks     map[string]bool
+	resources map[string]int
+}
+
+//
+// Waiters are served highest priority first then in order of arrival
+//
+
+type waiter struct {
+	holder *client
+	queued time.Time
+}
+
+var stateMutex     sync.Mutex
+var lockHolders    = make(map[string]*client)
+var lockQueues     = make(map[string][]waiter)
+var resourceUsers  = make(map[string]map[*client]int)
+var resourceQueues = make(map[string][]waiter)
+
+//
+// Client side - single connection kept open for the life of the process
+//
+
+var connection net.Conn
+var connReader *bufio.Reader
+
+// Local functions
+
+func splitAddress (address string) (string, string) {
+	logger.Debugf("Splitting coordinator address %s ...", address)
+
+	network := "tcp"
+
+	if strings.HasPrefix(address, "unix:") {
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix:")
+	} else {
+		address = strings.TrimPrefix(address, "tcp:")
+	}
+
+	logger.Debugf("Network %s, address %s", network, address)
+
+	return network, address
+}
+
+func readCapacity (resourceName string) (int, error) {
+	logger.Debugf("Reading capacity of resource %s ...", resourceName)
+
+	resourceFile, err := os.Open(setup.ResourceFileName)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resourceFile.Close()
+
+	resourceScanner := bufio.NewScanner(resourceFile)
+
+	for resourceScanner.Scan() {
+		resourceLine := strings.TrimSpace(resourceScanner.Text())
+
+		if resourceLine == "" || resourceLine[0] == '#' {
+			continue
+		}
+
+		resourceTokens := strings.SplitN(resourceLine, ":", 2)
+
+		if len(resourceTokens) == 2 && strings.TrimSpace(resourceTokens[0]) == resourceName {
+			return strconv.Atoi(strings.TrimSpace(resourceTokens[1]))
+		}
+	}
+
+	return 0, fmt.Errorf("resource %s not found in file %s", resourceName, setup.ResourceFileName)
+}
+
+func (holder *client) String() string {
+	return strings.Join( []string{ holder.pid, holder.host }, "@")
+}
+
+func joinQueue (queue []waiter, holder *client) ([]waiter, int) {
+	// Caller holds stateMutex - returns the queue and our position in it
+
+	queued := false
+
+	for _, entry := range queue {
+		if entry.holder == holder {
+			queued = true
+			break
+		}
+	}
+
+	if ! queued {
+		queue = append(queue, waiter{ holder: holder, queued: time.Now() })
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].holder.priority != queue[j].holder.priority {
+			return queue[i].holder.priority > queue[j].holder.priority
+		}
+		return queue[i].queued.Before(queue[j].queued)
+	})
+
+	for queueIndex, entry := range queue {
+		if entry.holder == holder {
+			return queue, queueIndex + 1
+		}
+	}
+
+	return queue, 0
+}
+
+func leaveQueue (queue []waiter, holder *client) []waiter {
+	// Caller holds stateMutex
+
+	var newQueue []waiter
+
+	for _, entry := range queue {
+		if entry.holder != holder {
+			newQueue = append(newQueue, entry)
+		}
+	}
+
+	return newQueue
+}
+
+func handleCommand (holder *client, fields []string) string {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	switch fields[0] {
+	case "HELLO":
+		if len(fields) != 4 {
+			return "ERR usage HELLO pid host priority"
+		}
+
+		holder.pid  = fields[1]
+		holder.host = fields[2]
+
+		holder.priority, _ = strconv.Atoi(fields[3])
+
+		logger.Infof("Client %s connected", holder)
+	case "LOCK":
+		if len(fields) != 2 {
+			return "ERR usage LOCK name"
+		}
+
+		if lockHolders[fields[1]] == holder {
+			return "OK"
+		}
+
+		var queuePosition int
+
+		lockQueues[fields[1]], queuePosition = joinQueue(lockQueues[fields[1]], holder)
+
+		queueLength := strconv.Itoa(len(lockQueues[fields[1]]))
+
+		if lockHolder, lockExists := lockHolders[fields[1]]; lockExists {
+			logger.Debugf("Lock %s requested by %s is held by %s", fields[1], holder, lockHolder)
+			return strings.Join( []string{ "BUSY", strconv.Itoa(queuePosition), queueLength, lockHolder.String() }, " ")
+		}
+
+		if queuePosition != 1 {
+			logger.Debugf("Lock %s requested by %s is queued at position %d", fields[1], holder, queuePosition)
+			return strings.Join( []string{ "BUSY", strconv.Itoa(queuePosition), queueLength }, " ")
+		}
+
+		lockQueues[fields[1]] = leaveQueue(lockQueues[fields[1]], holder)
+
+		lockHolders[fields[1]] = holder
+		holder.locks[fields[1]] = true
+
+		logger.Infof("Lock %s given to %s", fields[1], holder)
+	case "UNLOCK":
+		if len(fields) != 2 {
+			return "ERR usage UNLOCK name"
+		}
+
+		if lockHolders[fields[1]] == holder {
+			delete(lockHolders, fields[1])
+			delete(holder.locks, fields[1])
+
+			logger.Infof("Lock %s released by %s", fields[1], holder)
+		}
+	case "ACQUIRE":
+		if len(fields) != 3 {
+			return "ERR usage ACQUIRE name units"
+		}
+
+		resourceName := fields[1]
+
+		units, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return "ERR units must be a number"
+		}
+
+		capacity, err := readCapacity(resourceName)
+		if err != nil {
+			return strings.Join( []string{ "ERR", err.Error() }, " ")
+		}
+
+		used := 0
+
+		for _, usedUnits := range resourceUsers[resourceName] {
+			used += usedUnits
+		}
+
+		// Only the head of the queue may allocate so later arrivals cannot starve it
+
+		var queuePosition int
+
+		resourceQueues[resourceName], queuePosition = joinQueue(resourceQueues[resourceName], holder)
+
+		queueLength := strconv.Itoa(len(resourceQueues[resourceName]))
+
+		granted := 0
+
+		if queuePosition == 1 {
+			granted = capacity - used
+
+			if granted >= units {
+				granted = units
+
+				resourceQueues[resourceName] = leaveQueue(resourceQueues[resourceName], holder)
+			}
+		}
+
+		if granted > 0 {
+			if resourceUsers[resourceName] == nil {
+				resourceUsers[resourceName] = make(map[*client]int)
+			}
+
+			resourceUsers[resourceName][holder] += granted
+			holder.resources[resourceName] += granted
+
+			logger.Infof("Resource %s given %d units to %s", resourceName, granted, holder)
+		} else {
+			granted = 0
+		}
+
+		return strings.Join( []string{ "OK", strconv.Itoa(granted), strconv.Itoa(queuePosition), queueLength }, " ")
+	case "ACQUIREALL":
+		if len(fields) != 2 {
+			return "ERR usage ACQUIREALL name=units,name=units"
+		}
+
+		// Nothing is given until every resource fits - reply OK 1 or OK 0 with the first resource holding us up
+
+		requested := make(map[string]int)
+
+		var resourceNames []string
+
+		for _, resourceRequest := range strings.Split(fields[1], ",") {
+			requestTokens := strings.SplitN(resourceRequest, "=", 2)
+
+			if len(requestTokens) != 2 {
+				return "ERR malformed resource request"
+			}
+
+			units, err := strconv.Atoi(requestTokens[1])
+			if err != nil {
+				return "ERR units must be a number"
+			}
+
+			requested[requestTokens[0]] = units
+			resourceNames = append(resourceNames, requestTokens[0])
+		}
+
+		sort.Strings(resourceNames)
+
+		blockedReply := ""
+
+		for _, resourceName := range resourceNames {
+			capacity, err := readCapacity(resourceName)
+			if err != nil {
+				return strings.Join( []string{ "ERR", err.Error() }, " ")
+			}
+
+			used := 0
+
+			for _, usedUnits := range resourceUsers[resourceName] {
+				used += usedUnits
+			}
+
+			var queuePosition int
+
+			resourceQueues[resourceName], queuePosition = joinQueue(resourceQueues[resourceName], holder)
+
+			if blockedReply == "" && (queuePosition != 1 || capacity - used < requested[resourceName]) {
+				blockedReply = strings.Join( []string{ "OK", "0", resourceName, strconv.Itoa(queuePosition), strconv.Itoa(len(resourceQueues[resourceName])) }, " ")
+			}
+		}
+
+		if blockedReply != "" {
+			return blockedReply
+		}
+
+		for _, resourceName := range resourceNames {
+			if resourceUsers[resourceName] == nil {
+				resourceUsers[resourceName] = make(map[*client]int)
+			}
+
+			resourceUsers[resourceName][holder] += requested[resourceName]
+			holder.resources[resourceName] += requested[resourceName]
+
+			resourceQueues[resourceName] = leaveQueue(resourceQueues[resourceName], holder)
+
+			logger.Infof("Resource %s given %d units to %s", resourceName, requested[resourceName], holder)
+		}
+
+		return "OK 1"
+	case "RELEASE":
+		for resourceName := range resourceQueues {
+			resourceQueues[resourceName] = leaveQueue(resourceQueues[resourceName], holder)
+		}
+
+		releaseResources(holder)
+	default:
+		return strings.Join( []string{ "ERR unknown command", fields[0] }, " ")
+	}
+
+	return "OK"
+}
+
+func releaseResources (holder *client) {
+	// Caller holds stateMutex
+
+	for resourceName, units := range holder.resources {
+		delete(resourceUsers[resourceName], holder)
+
+		logger.Infof("Resource %s released %d units from %s", resourceName, units, holder)
+	}
+
+	holder.resources = make(map[string]int)
+}
+
+func releaseClient (holder *client) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	for lockName := range holder.locks {
+		if lockHolders[lockName] == holder {
+			delete(lockHolders, lockName)
+			logger.Infof("Lock %s released as %s disconnected", lockName, holder)
+		}
+	}
+
+	for lockName := range lockQueues {
+		lockQueues[lockName] = leaveQueue(lockQueues[lockName], holder)
+	}
+
+	for resourceName := range resourceQueues {
+		resourceQueues[resourceName] = leaveQueue(resourceQueues[resourceName], holder)
+	}
+
+	releaseResources(holder)
+}
+
+func serveClient (conn net.Conn) {
+	defer conn.Close()
+
+	holder := &client{ locks: make(map[string]bool), resources: make(map[string]int) }
+
+	clientScanner := bufio.NewScanner(conn)
+
+	for clientScanner.Scan() {
+		fields := strings.Fields(clientScanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		reply := handleCommand(holder, fields)
+
+		if _, err := fmt.Fprintf(conn, "%s\n", reply); err != nil {
+			logger.Warnf("Unable to reply to client %s - %s", holder, err)
+			break
+		}
+	}
+
+	releaseClient(holder)
+
+	logger.Infof("Client %s disconnected", holder)
+}
+
+func request (command string) string {
+	logger.Debugf("Sending coordinator request %s ...", command)
+
+	if connection == nil {
+		network, address := splitAddress(config.ConfigValues["CoordinatorAddress"])
+
+		var err error
+
+		connection, err = net.Dial(network, address)
+		if err != nil {
+			logger.Errorf("Unable to connect to coordinator %s - %s", config.ConfigValues["CoordinatorAddress"], err)
+		}
+
+		connReader = bufio.NewReader(connection)
+
+		hello := strings.Join( []string{ "HELLO", setup.CurrentPID, setup.HostName, strconv.Itoa(setup.Priority) }, " ")
+
+		if reply := request(hello); reply != "OK" {
+			logger.Errorf("Coordinator refused connection - %s", reply)
+		}
+	}
+
+	if _, err := fmt.Fprintf(connection, "%s\n", command); err != nil {
+		logger.Errorf("Unable to send request to coordinator - %s", err)
+	}
+
+	reply, err := connReader.ReadString('\n')
+	if err != nil {
+		logger.Errorf("Unable to read reply from coordinator - %s", err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	logger.Debugf("Coordinator replied %s", reply)
+
+	if strings.HasPrefix(reply, "ERR") {
+		logger.Errorf("Coordinator request %s failed - %s", command, reply)
+	}
+
+	return reply
+}
+
+// Global functions
+
+func Enabled () bool {
+	return config.ConfigValues["CoordinatorAddress"] != ""
+}
+
+func RunDaemon () {
+	logger.Info("Starting coordination daemon ...")
+
+	if ! Enabled() {
+		logger.Errorf("CoordinatorAddress must be set in the config file to run the daemon")
+	}
+
+	network, address := splitAddress(config.ConfigValues["CoordinatorAddress"])
+
+	if network == "unix" {
+		// A socket left behind by a previous daemon stops us listening
+
+		if _, err := os.Stat(address); err == nil {
+			logger.Warnf("Removing old socket file %s", address)
+			os.Remove(address)
+		}
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		logger.Errorf("Unable to listen on %s - %s", config.ConfigValues["CoordinatorAddress"], err)
+	}
+
+	logger.Infof("Coordinator listening on %s", config.ConfigValues["CoordinatorAddress"])
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Warnf("Unable to accept connection - %s", err)
+			continue
+		}
+
+		go serveClient(conn)
+	}
+}
+
+func Lock (lockName string) (bool, int, int, string) {
+	logger.Debugf("Requesting lock %s from coordinator ...", lockName)
+
+	reply := request(strings.Join( []string{ "LOCK", lockName }, " "))
+
+	if reply == "OK" {
+		return true, 0, 0, ""
+	}
+
+	// BUSY position length [holder]
+
+	replyTokens := strings.Fields(reply)
+
+	queuePosition, queueLength, lockHolder := 0, 0, ""
+
+	if len(replyTokens) >= 3 {
+		queuePosition, _ = strconv.Atoi(replyTokens[1])
+		queueLength, _   = strconv.Atoi(replyTokens[2])
+	}
+
+	if len(replyTokens) >= 4 {
+		lockHolder = replyTokens[3]
+	}
+
+	return false, queuePosition, queueLength, lockHolder
+}
+
+func Unlock (lockName string) {
+	logger.Debugf("Releasing lock %s with coordinator ...", lockName)
+
+	request(strings.Join( []string{ "UNLOCK", lockName }, " "))
+
+	logger.Debug("Process complete")
+}
+
+func Acquire (resourceName string, units int) (int, int, int) {
+	logger.Debugf("Requesting %d units of %s from coordinator ...", units, resourceName)
+
+	reply := request(strings.Join( []string{ "ACQUIRE", resourceName, strconv.Itoa(units) }, " "))
+
+	// OK granted position length
+
+	replyTokens := strings.Fields(reply)
+
+	if len(replyTokens) != 4 {
+		logger.Errorf("Invalid reply from coordinator - %s", reply)
+	}
+
+	granted, err := strconv.Atoi(replyTokens[1])
+	if err != nil {
+		logger.Errorf("Invalid reply from coordinator - %s", reply)
+	}
+
+	queuePosition, _ := strconv.Atoi(replyTokens[2])
+	queueLength, _   := strconv.Atoi(replyTokens[3])
+
+	logger.Debugf("Coordinator granted %d units", granted)
+
+	return granted, queuePosition, queueLength
+}
+
+func AcquireAll (resources map[string]int) (bool, string, int, int) {
+	logger.Debug("Requesting all resources from coordinator ...")
+
+	var resourceRequests []string
+
+	for resourceName, resourceValue := range resources {
+		resourceRequests = append(resourceRequests, strings.Join( []string{ resourceName, strconv.Itoa(resourceValue) }, "="))
+	}
+
+	reply := request(strings.Join( []string{ "ACQUIREALL", strings.Join(resourceRequests, ",") }, " "))
+
+	if reply == "OK 1" {
+		return true, "", 0, 0
+	}
+
+	// OK 0 name position length
+
+	replyTokens := strings.Fields(reply)
+
+	if len(replyTokens) != 5 {
+		logger.Errorf("Invalid reply from coordinator - %s", reply)
+	}
+
+	queuePosition, _ := strconv.Atoi(replyTokens[3])
+	queueLength, _   := strconv.Atoi(replyTokens[4])
+
+	return false, replyTokens[2], queuePosition, queueLength
+}
+
+func Release () {
+	logger.Debug("Releasing resources with coordinator ...")
+
+	request("RELEASE")
+
+	logger.Debug("Process complete")
+}
@@ -0,0 +1,124 @@
+package coordinator
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daviesluke/run_rman/config"
+	"github.com/daviesluke/setup"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startDaemon(t *testing.T) string {
+	// Socket paths are limited in length so keep clear of long test directories
+	socketDir, err := os.MkdirTemp("", "coord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(socketDir) })
+
+	setup.ResourceFileName = filepath.Join(socketDir, "resource.cfg")
+	if err := os.WriteFile(setup.ResourceFileName, []byte("# Test resources\ntape:2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	socketName := filepath.Join(socketDir, "run_rman.sock")
+	config.ConfigValues["CoordinatorAddress"] = "unix:" + socketName
+
+	go RunDaemon()
+
+	for attempt := 0; attempt < 100; attempt++ {
+		if conn, err := net.Dial("unix", socketName); err == nil {
+			conn.Close()
+			return socketName
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Coordinator not listening on %s", socketName)
+	return ""
+}
+
+func connect(t *testing.T, socketName string, pid string, host string) *testClient {
+	conn, err := net.Dial("unix", socketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	holder := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	holder.expect(t, "HELLO "+pid+" "+host+" 0", "OK")
+	return holder
+}
+
+func (holder *testClient) send(t *testing.T, command string) string {
+	if _, err := fmt.Fprintf(holder.conn, "%s\n", command); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := holder.reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(reply)
+}
+
+func (holder *testClient) expect(t *testing.T, command string, expected string) {
+	t.Helper()
+	if reply := holder.send(t, command); reply != expected {
+		t.Fatalf("%s replied %q not %q", command, reply, expected)
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	socketName := startDaemon(t)
+
+	first := connect(t, socketName, "100", "hostA")
+	second := connect(t, socketName, "200", "hostB")
+
+	// Locks - the second client queues behind the holder until it unlocks
+	first.expect(t, "LOCK level0", "OK")
+	first.expect(t, "LOCK level0", "OK")
+	second.expect(t, "LOCK level0", "BUSY 1 1 100@hostA")
+	second.expect(t, "UNLOCK level0", "OK")
+	first.expect(t, "UNLOCK level0", "OK")
+	second.expect(t, "LOCK level0", "OK")
+	first.expect(t, "LOCK level0", "BUSY 1 1 200@hostB")
+
+	// Resources - only what is free is given and the head of the queue is served first
+	first.expect(t, "ACQUIRE tape 2", "OK 2 1 1")
+	second.expect(t, "ACQUIRE tape 1", "OK 0 1 1")
+	second.expect(t, "ACQUIREALL tape=1", "OK 0 tape 1 1")
+	first.expect(t, "RELEASE", "OK")
+	second.expect(t, "ACQUIRE tape 1", "OK 1 1 1")
+	first.expect(t, "ACQUIRE tape 2", "OK 1 1 1")
+	first.expect(t, "RELEASE", "OK")
+
+	// Everything the second client holds goes when it disconnects
+	second.conn.Close()
+
+	for attempt := 0; ; attempt++ {
+		if reply := first.send(t, "LOCK level0"); reply == "OK" {
+			break
+		} else if attempt == 100 {
+			t.Fatalf("Lock not released on disconnect - %s", reply)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	first.expect(t, "ACQUIREALL tape=2", "OK 1")
+
+	// Malformed requests are refused without closing the connection
+	first.expect(t, "LOCK", "ERR usage LOCK name")
+	first.expect(t, "ACQUIRE tape two", "ERR units must be a number")
+	first.expect(t, "ACQUIRE disk 1", "ERR resource disk not found in file "+setup.ResourceFileName)
+	first.expect(t, "SHUTDOWN", "ERR unknown command SHUTDOWN")
+	first.expect(t, "UNLOCK level0", "OK")
+}
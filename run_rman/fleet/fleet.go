@@ -0,0 +1,226 @@
+package fleet
+
+// Standard imports
+
+import "flag"
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/run_rman/config"
+import "github.com/daviesluke/run_rman/history"
+import "github.com/daviesluke/run_rman/oratab"
+
+// local variables
+
+//
+// run_rman keeps one database per process so each database is run as a child run_rman
+// with -d set to that database.  Children do not send e-mail, the parent sends a summary
+//
+
+var childSkipFlags = map[string]bool {
+	"d"          : true,
+	"db"         : true,
+	"e"          : true,
+	"E"          : true,
+	"email"      : true,
+	"erroremail" : true,
+}
+
+type fleetResult struct {
+	Database string
+	PID      int
+	Status   string
+	Duration time.Duration
+}
+
+// local functions
+
+func oratabDatabases () []string {
+	logger.Info("Finding databases in the oratab files ...")
+
+	var databases []string
+
+	for _, oratabEntry := range oratab.Read(config.ConfigValues["OraTabPath"]).Databases() {
+		if oratabEntry.Flag == "N" {
+			logger.Infof("Skipping %s as it is flagged N in %s", oratabEntry.SID, oratabEntry.FileName)
+			continue
+		}
+
+		databases = append(databases, oratabEntry.SID)
+	}
+
+	logger.Debug("Process complete")
+
+	return databases
+}
+
+func childArgs ( flagSet *flag.FlagSet, database string ) []string {
+	logger.Debugf("Setting arguments for database %s ...", database)
+
+	childArgs := []string{ "-d", database }
+
+	// Rebuilt from the parsed flags so flag values are never mistaken for flags or the script
+
+	flagSet.Visit(func(flagParam *flag.Flag) {
+		if ! childSkipFlags[flagParam.Name] {
+			childArgs = append(childArgs, "-" + flagParam.Name + "=" + flagParam.Value.String())
+		}
+	})
+
+	childArgs = append(childArgs, flagSet.Args()...)
+
+	logger.Debugf("Arguments set to %v", childArgs)
+
+	return childArgs
+}
+
+func runDatabase ( programName string, database string ) fleetResult {
+	logger.Infof("Starting run for database %s ...", database)
+
+	fleetResult := fleetResult{ Database: database, Status: "FAILURE" }
+
+	startTime := time.Now()
+
+	childCommand := exec.Command(programName, childArgs(flag.CommandLine, database)...)
+
+	childCommand.Stdout = os.Stdout
+	childCommand.Stderr = os.Stderr
+
+	if err := childCommand.Start(); err != nil {
+		logger.Warnf("Unable to start run for database %s - %s", database, err)
+		return fleetResult
+	}
+
+	fleetResult.PID = childCommand.Process.Pid
+
+	childErr := childCommand.Wait()
+
+	fleetResult.Duration = time.Since(startTime)
+
+	// The child's own history record tells a skipped run from a success
+
+	fleetResult.Status = "SUCCESS"
+
+	if childErr != nil {
+		fleetResult.Status = "FAILURE"
+	}
+
+	for _, historyRecord := range history.ReadHistory(setup.HistStoreFileName, database, "", time.Since(startTime) + time.Minute) {
+		if historyRecord.PID == fleetResult.PID {
+			fleetResult.Status = historyRecord.Status
+		}
+	}
+
+	logger.Infof("Run for database %s (PID %d) finished with status %s in %s", database, fleetResult.PID, fleetResult.Status, fleetResult.Duration.Round(time.Second))
+
+	return fleetResult
+}
+
+// Global functions
+
+func IsFleet ( database string ) bool {
+	return strings.ToUpper(database) == "ALL" || strings.Contains(database, ",")
+}
+
+func Databases ( databaseList string ) []string {
+	logger.Infof("Getting databases for %s ...", databaseList)
+
+	var databases []string
+
+	if strings.ToUpper(databaseList) == "ALL" {
+		databases = oratabDatabases()
+	} else {
+		for _, database := range strings.Split(databaseList, ",") {
+			if database = strings.TrimSpace(database); database != "" {
+				databases = append(databases, database)
+			}
+		}
+	}
+
+	if len(databases) == 0 {
+		logger.Errorf("No databases found to run for %s", databaseList)
+	}
+
+	logger.Infof("Databases to run - %s", strings.Join(databases, ", "))
+
+	logger.Debug("Process complete")
+
+	return databases
+}
+
+func Run ( databases []string ) {
+	logger.Info("Running for each database ...")
+
+	fleetConcurrency, err := strconv.Atoi(config.ConfigValues["FleetConcurrency"])
+	if err != nil || fleetConcurrency < 1 {
+		logger.Errorf("FleetConcurrency %s must be a number of at least 1", config.ConfigValues["FleetConcurrency"])
+	}
+
+	programName, err := os.Executable()
+	if err != nil {
+		logger.Errorf("Unable to get the program name - %s", err)
+	}
+
+	logger.Infof("Running %d databases, %d at a time", len(databases), fleetConcurrency)
+
+	fleetResults := make([]fleetResult, len(databases))
+
+	fleetSlots := make(chan bool, fleetConcurrency)
+
+	var fleetWait sync.WaitGroup
+
+	for databaseIndex, database := range databases {
+		fleetSlots <- true
+
+		fleetWait.Add(1)
+
+		go func(databaseIndex int, database string) {
+			defer fleetWait.Done()
+
+			fleetResults[databaseIndex] = runDatabase(programName, database)
+
+			<-fleetSlots
+		}(databaseIndex, database)
+	}
+
+	fleetWait.Wait()
+
+	// Summary in the log which is the body of the e-mail
+
+	var failedDatabases []string
+
+	logger.Info("Fleet summary")
+
+	for _, fleetResult := range fleetResults {
+		logger.Infof("  %-12s  %-8s  %10s  PID %d", fleetResult.Database, fleetResult.Status, fleetResult.Duration.Round(time.Second), fleetResult.PID)
+
+		if fleetResult.Status == "FAILURE" {
+			failedDatabases = append(failedDatabases, fleetResult.Database)
+		}
+	}
+
+	logger.Infof("Logs for each database are in %s", filepath.Clean(setup.LogDir))
+
+	// Not through Errorf as that does not mail the summary and would record a run for FLEET
+
+	if len(failedDatabases) > 0 {
+		logger.Warnf("%d of %d databases failed - %s", len(failedDatabases), len(databases), strings.Join(failedDatabases, ", "))
+
+		logger.SendLog("ERROR")
+
+		os.Exit(1)
+	}
+
+	logger.SendLog("SUCCESS")
+
+	logger.Info("Process complete")
+}
@@ -0,0 +1,82 @@
+package fleet
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/daviesluke/run_rman/config"
+	"github.com/daviesluke/setup"
+)
+
+func testFlags(t *testing.T, args ...string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet("run_rman", flag.ContinueOnError)
+	for _, name := range []string{"d", "db", "e", "E", "email", "erroremail", "l", "lock", "c"} {
+		flagSet.String(name, "", name)
+	}
+	flagSet.Bool("validate", false, "validate")
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flagSet
+}
+
+func TestChildArgs(t *testing.T) {
+	checks := []struct {
+		args     []string
+		expected []string
+	}{
+		// The lock value is not the script so the -d after it must still be dropped
+		{[]string{"-l", "LOCK", "-d", "ALL", "level0.rcv"}, []string{"-d", "DB1", "-l=LOCK", "level0.rcv"}},
+		{[]string{"-db=DB1,DB2", "-e", "a@b.com", "-E", "c@d.com", "-c", "my.cfg", "arch.rcv"}, []string{"-d", "DB1", "-c=my.cfg", "arch.rcv"}},
+		{[]string{"-validate", "-lock", "L", "-email", "a@b.com", "-d", "ALL"}, []string{"-d", "DB1", "-lock=L", "-validate=true"}},
+	}
+	for _, check := range checks {
+		if childArgs := childArgs(testFlags(t, check.args...), "DB1"); !reflect.DeepEqual(childArgs, check.expected) {
+			t.Fatalf("Arguments for %v are %v not %v", check.args, childArgs, check.expected)
+		}
+	}
+}
+
+func TestIsFleet(t *testing.T) {
+	checks := map[string]bool{
+		"ALL":       true,
+		"all":       true,
+		"ORCL,TEST": true,
+		"ORCL,":     true,
+		"ORCL":      false,
+		"ALLDB":     false,
+	}
+	for database, expected := range checks {
+		if isFleet := IsFleet(database); isFleet != expected {
+			t.Fatalf("IsFleet %q is %v not %v", database, isFleet, expected)
+		}
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	setup.PathDelimiter = ":"
+
+	oratabName := filepath.Join(t.TempDir(), "oratab")
+	oratabLines := "*:/u01/app/19c:N\n+ASM:/u01/app/grid:Y\nORCL:/u01/app/19c:Y\nTEST:/u01/app/19c:N\nDEV:/u01/app/19c:\nORCL:/u01/app/21c:N\n"
+	if err := os.WriteFile(oratabName, []byte(oratabLines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.ConfigValues["OraTabPath"] = oratabName
+
+	checks := map[string][]string{
+		// ALL skips ASM, the * entry and anything flagged N
+		"ALL":              {"ORCL", "DEV"},
+		"all":              {"ORCL", "DEV"},
+		"ORCL,TEST":        {"ORCL", "TEST"},
+		" ORCL , PROD ,, ": {"ORCL", "PROD"},
+		"TEST":             {"TEST"},
+	}
+	for databaseList, expected := range checks {
+		if databases := Databases(databaseList); !reflect.DeepEqual(databases, expected) {
+			t.Fatalf("Databases for %q are %v not %v", databaseList, databases, expected)
+		}
+	}
+}
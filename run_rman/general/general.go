@@ -4,6 +4,7 @@ package general
 
 import "flag"
 import "os"
+import "os/exec"
 import "path/filepath"
 import "runtime"
 import "strings"
@@ -17,6 +18,7 @@ import "github.com/daviesluke/setup"
 import "github.com/daviesluke/utils"
 import "github.com/daviesluke/run_rman/config"
 import "github.com/daviesluke/run_rman/locker"
+import "github.com/daviesluke/run_rman/oratab"
 import "github.com/daviesluke/run_rman/resource"
 
 
@@ -31,6 +33,16 @@ var email      = flag.String("email"      , "", "E-mail list for success / failu
 var lock       = flag.String("lock"       , "", "Lock name")
 var logDir     = flag.String("log"        , "", "Directory for logs")
 var resList    = flag.String("resource"   , "", "Resource name")
+var daemon     = flag.Bool("daemon"       , false, "Run as lock and resource coordinator")
+var priority   = flag.Int("priority"      , 0, "Queue priority for locks and resources")
+var showRes    = flag.Bool("resources"    , false, "Show resource capacity, holders and waiters")
+var releaseRes = flag.String("releaseresources", "", "Release resources held by PID or PID@HOST")
+var showHist   = flag.Bool("history"      , false, "Show run history")
+var histScript = flag.String("script"     , "", "Script name for history")
+var histSince  = flag.String("since"      , "", "Age of runs for history e.g. 7d or 12h")
+var showReport = flag.Bool("report"       , false, "Report backup coverage and recoverability")
+var validate   = flag.Bool("validate"     , false, "Run restore validation instead of a script")
+var catalog    = flag.Bool("catalog"      , false, "Check catalog health")
 
 // Global Variables
 
@@ -43,6 +55,21 @@ var Resources         map[string]int
 
 var RMAN              string
 
+var DaemonMode        bool
+
+var ShowResources     bool
+var ReleaseOwner      string
+
+var ShowHistory       bool
+var HistoryScript     string
+var HistorySince      time.Duration
+
+var ShowReport        bool
+
+var ValidateMode      bool
+
+var CheckCatalog      bool
+
 // Local functions
 
 func init() {
@@ -57,6 +84,101 @@ func init() {
 	flag.StringVar(lock      , "l", "", "Lock name")
 	flag.StringVar(logDir    , "L", "", "Alternative Log directory")
 	flag.StringVar(resList   , "r", "", "Resource name")
+	flag.IntVar(priority     , "p", 0, "Queue priority for locks and resources")
+}
+
+func parseSince ( since string ) time.Duration {
+	logger.Debugf("Parsing age %s ...", since)
+
+	// Plain numbers and a d suffix are days as time.ParseDuration stops at hours
+
+	sinceDays := strings.TrimSuffix(since, "d")
+
+	if days, err := strconv.Atoi(sinceDays); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+
+	sinceDuration, err := time.ParseDuration(since)
+	if err != nil || sinceDuration < 0 {
+		logger.Errorf("Invalid age %s. Use days such as 7d or a duration such as 12h", since)
+	}
+
+	logger.Debug("Process complete")
+
+	return sinceDuration
+}
+
+func sourceEnvFile ( envFile string ) {
+	logger.Infof("Setting environment from %s ...", envFile)
+
+	if runtime.GOOS == "windows" {
+		logger.Warn("EnvFile is not supported on Windows - ignoring")
+		return
+	}
+
+	// Sourced in a subshell with the SID set and oraenv told not to ask.  The environment is
+	// printed after a marker so anything the script prints is not taken as a variable
+
+	envMarker := "==== run_rman environment " + setup.CurrentPID + " ===="
+
+	envShell := "/bin/bash"
+
+	if _, err := os.Stat(envShell); err != nil {
+		envShell = "/bin/sh"
+	}
+
+	envCommand := exec.Command(envShell, "-c", ". " + envFile + " </dev/null >/dev/null 2>&1; echo '" + envMarker + "'; env")
+
+	envCommand.Env = append(os.Environ(), "ORACLE_SID=" + setup.Database, "ORAENV_ASK=NO")
+
+	envOutput, err := envCommand.Output()
+	if err != nil {
+		logger.Errorf("Unable to run environment file %s - %s", envFile, err)
+	}
+
+	envLines := strings.Split(string(envOutput), "\n")
+
+	markerFound := false
+	envName     := ""
+
+	envValues := make(map[string]string)
+
+	for _, envLine := range envLines {
+		if ! markerFound {
+			markerFound = envLine == envMarker
+			continue
+		}
+
+		// Lines without = continue a value containing a newline
+
+		if equalIndex := strings.Index(envLine, "="); equalIndex > 0 && utils.CheckRegEx(envLine[:equalIndex], "^[A-Za-z_][A-Za-z0-9_]*$") {
+			envName = envLine[:equalIndex]
+			envValues[envName] = envLine[equalIndex+1:]
+		} else if envName != "" {
+			envValues[envName] += "\n" + envLine
+		}
+	}
+
+	if ! markerFound {
+		logger.Errorf("Environment file %s did not complete", envFile)
+	}
+
+	// Only the Oracle settings are taken.  The OCI library is already loaded so library paths
+	// only affect RMAN but TNS_ADMIN and NLS settings are read by the connection checks too
+
+	envRegEx := "^(ORACLE_HOME|ORACLE_BASE|TNS_ADMIN|PATH|LD_LIBRARY_PATH|LIBPATH|SHLIB_PATH|DYLD_LIBRARY_PATH|NLS_.+|ORA_.+)$"
+
+	for envName, envValue := range envValues {
+		if ! utils.CheckRegEx(envName, envRegEx) || os.Getenv(envName) == envValue {
+			continue
+		}
+
+		logger.Infof("Setting %s to %s from %s", envName, envValue, envFile)
+
+		os.Setenv(envName, envValue)
+	}
+
+	logger.Debug("Process complete")
 }
 
 func removeOldFiles ( dirName string, fileFilter string , daysOld int ) {
@@ -137,6 +259,39 @@ func ValidateFlags () {
 			setup.SetDatabase(*database)
 		} else if flagParam.Name == "lock" || flagParam.Name == "l" {
 			SetLock(*lock)
+		} else if flagParam.Name == "priority" || flagParam.Name == "p" {
+			setup.SetPriority(*priority)
+		} else if flagParam.Name == "daemon" {
+			DaemonMode = *daemon
+			logger.Debugf("Daemon mode set to %t", DaemonMode)
+		} else if flagParam.Name == "resources" {
+			ShowResources = *showRes
+			logger.Debugf("Show resources set to %t", ShowResources)
+		} else if flagParam.Name == "releaseresources" {
+			if utils.CheckRegEx(*releaseRes, "^[0-9]+(@[a-zA-Z0-9_.-]+)?$") {
+				ReleaseOwner = *releaseRes
+				logger.Debugf("Release resources owner set to %s", ReleaseOwner)
+			} else {
+				logger.Errorf("Invalid process to release - %s. Use PID or PID@HOST", *releaseRes)
+			}
+		} else if flagParam.Name == "history" {
+			ShowHistory = *showHist
+			logger.Debugf("Show history set to %t", ShowHistory)
+		} else if flagParam.Name == "script" {
+			HistoryScript = strings.SplitN(filepath.Base(*histScript), ".", 2)[0]
+			logger.Debugf("History script set to %s", HistoryScript)
+		} else if flagParam.Name == "since" {
+			HistorySince = parseSince(*histSince)
+			logger.Debugf("History since set to %s", HistorySince)
+		} else if flagParam.Name == "report" {
+			ShowReport = *showReport
+			logger.Debugf("Show report set to %t", ShowReport)
+		} else if flagParam.Name == "validate" {
+			ValidateMode = *validate
+			logger.Debugf("Validate mode set to %t", ValidateMode)
+		} else if flagParam.Name == "catalog" {
+			CheckCatalog = *catalog
+			logger.Debugf("Check catalog set to %t", CheckCatalog)
 		}
 	}
 
@@ -199,7 +354,13 @@ func SetEnvironment ( database string ) {
 
 	logger.Infof("Database set to %s", setup.Database)
 
-	logger.SetHistoryVars(setup.HistFileName, setup.Database, config.RMANScriptBase)
+	// The monitoring commands are not runs so a failure must not be recorded in the history
+
+	if ShowReport || CheckCatalog {
+		logger.SetHistoryVars("", "", setup.Database, config.RMANScriptBase)
+	} else {
+		logger.SetHistoryVars(setup.HistFileName, setup.HistStoreFileName, setup.Database, config.RMANScriptBase)
+	}
 
 	// Sets the correct ORACLE_SID environment 
 
@@ -220,28 +381,45 @@ func SetEnvironment ( database string ) {
 
 	logger.Tracef("Looping around the OraTabPath %s", config.ConfigValues["OraTabPath"])
 
-	for _, envFile := range strings.Split(config.ConfigValues["OraTabPath"],setup.PathDelimiter) {
+	// An environment file sets the home itself otherwise the first oratab entry for the SID whose home has rman wins
 
-		logger.Debugf("Checking database in file %s", envFile)
+	if config.ConfigValues["EnvFile"] != "" {
+		sourceEnvFile(config.ConfigValues["EnvFile"])
 
-		// Check file exists
+		oracleHome = os.Getenv("ORACLE_HOME")
+	}
 
-		if _, err := os.Stat(envFile); err == nil {
-			oracleHome = utils.LookupFile(envFile,setup.Database,1,2,setup.PathDelimiter,1)
+	// TNS_ADMIN for wallets and aliases, used by the connection checks and RMAN
 
-			if oracleHome != "" {
-				logger.Debug("Found entry in file. Breaking loop ...")
-				break
+	if config.ConfigValues["TnsAdmin"] != "" {
+		if tnsInfo, err := os.Stat(config.ConfigValues["TnsAdmin"]); err != nil || ! tnsInfo.IsDir() {
+			logger.Warnf("TnsAdmin directory %s not found", config.ConfigValues["TnsAdmin"])
+		}
+
+		logger.Infof("Setting TNS_ADMIN to %s", config.ConfigValues["TnsAdmin"])
+
+		os.Setenv("TNS_ADMIN", config.ConfigValues["TnsAdmin"])
+	}
+
+	if oracleHome == "" {
+		for _, oratabEntry := range oratab.Read(config.ConfigValues["OraTabPath"]).Lookup(setup.Database) {
+			if ! oratabEntry.HasRMAN() {
+				logger.Warnf("Ignoring %s entry for %s at line %d - home %s does not contain %s", oratabEntry.FileName, oratabEntry.SID, oratabEntry.LineNo, oratabEntry.Home, oratabEntry.RMAN())
+				continue
 			}
-		} else {
-			logger.Trace("File not found. Ignoring ...")
+
+			logger.Infof("Found %s in %s at line %d - home %s", oratabEntry.SID, oratabEntry.FileName, oratabEntry.LineNo, oratabEntry.Home)
+
+			oracleHome = oratabEntry.Home
+
+			break
 		}
 	}
 
 	if oracleHome == "" {
 		// Check to see if it is set in the environment
 
-		oracleHome := os.Getenv("ORACLE_HOME")
+		oracleHome = os.Getenv("ORACLE_HOME")
 
 		if oracleHome == "" {
 			logger.Errorf("Unable to locate an Oracle Home.  Use the correct SID and environment file.")
@@ -398,24 +576,28 @@ func Cleanup() {
 
 	// Remove lock file if specified
 	if LockName != "" {
-		locker.RemoveLockEntry(setup.LockFileName,setup.CurrentPID)
+		locker.UnlockProcess(LockName)
 	}
 
 	// Release resources if specified
 	if len(Resources) > 0 {
-		resource.ReleaseResources(setup.ResourceObtainedFileName)
+		resource.ReleaseProcessResources()
 	}
 
 	logKeepTime, _ := strconv.Atoi(config.ConfigValues["LogKeepTime"])
 
+	// Rotated segments are .N or .N.gz after the log name
+
+	logSegment := "(\\.[0-9]+(\\.gz)?)?$"
+
 	// Removing old log files that have not yet been renamed
 
-	regEx := strings.Join( []string { "^", setup.BaseName, "_", "[0-9]+\\.log$"}, "")
+	regEx := strings.Join( []string { "^", setup.BaseName, "_", "[0-9]+\\.log", logSegment}, "")
 	removeOldFiles(setup.LogDir,regEx,logKeepTime)
 
 	// Removing old log files that have been renamed 
 
-	regEx = strings.Join( []string { "^", setup.BaseName, "_", setup.Database, "_", config.RMANScriptBase, "_([0-9]{14})+\\.log$"}, "")
+	regEx = strings.Join( []string { "^", setup.BaseName, "_", setup.Database, "_", config.RMANScriptBase, "_([0-9]{14})+\\.log", logSegment}, "")
 	removeOldFiles(setup.LogDir,regEx,logKeepTime)
 
 	// Removing old run files for config files (over 7 days old)
@@ -425,8 +607,18 @@ func Cleanup() {
 	removeOldFiles(setup.RMANScriptDir, regEx, 7)
 
 	// Removing old tmp files from previous runs (over 7 days old)
-	regEx = strings.Join( []string { "^", setup.BaseName, "\\.[0-9]+$" }, "")
+	regEx = strings.Join( []string { "^", setup.BaseName, "\\.[0-9]+(\\.[a-z]+\\.(rcv|out))?$" }, "")
 	removeOldFiles(setup.TmpDir, regEx, 7)
+
+	// Generated validation scripts
+
+	if ValidateMode {
+		if err := os.Remove(config.RMANScript); err != nil && ! os.IsNotExist(err) {
+			logger.Warnf("Unable to remove validation script %s", config.RMANScript)
+		}
+	}
+
+	removeOldFiles(setup.TmpDir, "^validate\\.[0-9]+\\.rcv(\\.[0-9]+)?$", 7)
 	
 	logger.Infof("Process complete")
 }
@@ -0,0 +1,313 @@
+package history
+
+// Standard imports
+
+import "bufio"
+import "encoding/json"
+import "fmt"
+import "math"
+import "os"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/run_rman/config"
+
+// local variables
+
+type scriptSummary struct {
+	Database  string
+	Script    string
+	Runs      int
+	Successes int
+	Skipped   int
+	Duration  float64
+}
+
+// Expected run time worked out from earlier runs
+
+var expectedWindow time.Duration
+var overrunTimer   *time.Timer
+
+// local functions
+
+func median ( values []float64 ) float64 {
+	sorted := append([]float64{}, values...)
+
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+
+	if len(sorted) % 2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
+
+func getIntConfig ( configName string ) int {
+	configValue, err := strconv.Atoi(config.ConfigValues[configName])
+	if err != nil || configValue < 0 {
+		logger.Errorf("Config entry %s must be a whole number not %s", configName, config.ConfigValues[configName])
+	}
+
+	return configValue
+}
+
+func formatBytes ( bytes int64 ) string {
+	units := []string{ "B", "KB", "MB", "GB", "TB", "PB" }
+
+	size := float64(bytes)
+	unitIndex := 0
+
+	for size >= 1024 && unitIndex < len(units) - 1 {
+		size /= 1024
+		unitIndex++
+	}
+
+	if unitIndex == 0 {
+		return fmt.Sprintf("%d%s", bytes, units[unitIndex])
+	}
+
+	return fmt.Sprintf("%.1f%s", size, units[unitIndex])
+}
+
+func formatDuration ( durationSecs float64 ) string {
+	return (time.Duration(durationSecs) * time.Second).String()
+}
+
+// Global functions
+
+func ReadHistory ( storeName string, database string, script string, since time.Duration ) []logger.HistoryRecord {
+	logger.Debugf("Reading history store %s ...", storeName)
+
+	var historyRecords []logger.HistoryRecord
+
+	store, err := os.Open(storeName)
+	if os.IsNotExist(err) {
+		logger.Infof("No history store %s yet", storeName)
+		return historyRecords
+	} else if err != nil {
+		logger.Warnf("Unable to open history store %s", storeName)
+		return historyRecords
+	}
+
+	defer store.Close()
+
+	var sinceTime time.Time
+
+	if since > 0 {
+		sinceTime = time.Now().Add(-since)
+	}
+
+	storeScanner := bufio.NewScanner(store)
+
+	lineNo := 0
+
+	for storeScanner.Scan() {
+		lineNo++
+
+		var historyRecord logger.HistoryRecord
+
+		if err := json.Unmarshal(storeScanner.Bytes(), &historyRecord); err != nil {
+			logger.Warnf("Ignoring invalid history line %d - %s", lineNo, err)
+			continue
+		}
+
+		if database != "" && ! strings.EqualFold(historyRecord.Database, database) {
+			continue
+		}
+
+		if script != "" && historyRecord.Script != script {
+			continue
+		}
+
+		if historyRecord.Start.Before(sinceTime) {
+			continue
+		}
+
+		historyRecords = append(historyRecords, historyRecord)
+	}
+
+	logger.Debugf("%d history records read", len(historyRecords))
+
+	return historyRecords
+}
+
+func Baseline ( storeName string, database string, script string, maxRuns int ) ( time.Duration, time.Duration, int ) {
+	logger.Debugf("Getting duration baseline for database %s script %s ...", database, script)
+
+	var durations []float64
+
+	for _, historyRecord := range ReadHistory(storeName, database, script, 0) {
+		if historyRecord.Status == "SUCCESS" {
+			durations = append(durations, historyRecord.Duration)
+		}
+	}
+
+	// Only the most recent runs so the baseline follows gradual changes in size
+
+	if len(durations) > maxRuns {
+		durations = durations[len(durations) - maxRuns:]
+	}
+
+	if len(durations) == 0 {
+		return 0, 0, 0
+	}
+
+	// Spread is the median absolute deviation scaled to match a standard deviation
+	// so one very slow run does not widen it
+
+	medianDuration := median(durations)
+
+	deviations := make([]float64, len(durations))
+
+	for i, duration := range durations {
+		deviations[i] = math.Abs(duration - medianDuration)
+	}
+
+	spread := 1.4826 * median(deviations)
+
+	logger.Debugf("Median %0.0f secs, spread %0.0f secs from %d runs", medianDuration, spread, len(durations))
+
+	return time.Duration(medianDuration * float64(time.Second)), time.Duration(spread * float64(time.Second)), len(durations)
+}
+
+func WatchDuration () {
+	logger.Info("Setting expected run time ...")
+
+	slowRunFactor, err := strconv.ParseFloat(config.ConfigValues["SlowRunFactor"], 64)
+	if err != nil || slowRunFactor < 0 {
+		logger.Errorf("Config entry SlowRunFactor must be a number not %s", config.ConfigValues["SlowRunFactor"])
+	}
+
+	if slowRunFactor == 0 {
+		logger.Info("Slow run checks are turned off")
+		return
+	}
+
+	medianDuration, spread, runs := Baseline(setup.HistStoreFileName, setup.Database, config.RMANScriptBase, getIntConfig("SlowRunHistory"))
+
+	if runs < getIntConfig("SlowRunMinRuns") {
+		logger.Infof("Only %d earlier successful runs - not checking for slow runs", runs)
+		return
+	}
+
+	// Allow at least 10% or a minute over the median so very steady runs are not flagged for seconds
+
+	allowance := time.Duration(slowRunFactor * float64(spread))
+
+	if allowance < medianDuration / 10 {
+		allowance = medianDuration / 10
+	}
+
+	if allowance < time.Minute {
+		allowance = time.Minute
+	}
+
+	expectedWindow = (medianDuration + allowance).Round(time.Second)
+
+	logger.Infof("Expected run time up to %s (median %s, spread %s from %d runs)", expectedWindow, medianDuration.Round(time.Second), spread.Round(time.Second), runs)
+
+	// Warn while still running so a sink such as syslog shows the overrun straight away
+
+	overrunTimer = time.AfterFunc(expectedWindow - logger.Elapsed(), func () {
+		logger.Warnf("Run still going after %s, longer than the expected %s", logger.Elapsed().Round(time.Second), expectedWindow)
+	})
+
+	logger.Debug("Process complete")
+}
+
+func CheckDuration () {
+	logger.Info("Checking run time against earlier runs ...")
+
+	if overrunTimer != nil {
+		overrunTimer.Stop()
+	}
+
+	if expectedWindow == 0 {
+		logger.Debug("No expected run time set")
+		return
+	}
+
+	runTime := logger.Elapsed().Round(time.Second)
+
+	if runTime > expectedWindow {
+		logger.Warnf("Run took %s which is slower than the expected %s", runTime, expectedWindow)
+
+		logger.AddNotice(fmt.Sprintf("SLOW RUN %s expected %s", runTime, expectedWindow))
+	} else {
+		logger.Infof("Run took %s within the expected %s", runTime, expectedWindow)
+	}
+
+	logger.Debug("Process complete")
+}
+
+func ShowHistory ( storeName string, database string, script string, since time.Duration ) {
+	logger.Info("Showing run history ...")
+
+	historyRecords := ReadHistory(storeName, database, script, since)
+
+	if len(historyRecords) == 0 {
+		fmt.Println("No runs found")
+		logger.Info("Process complete")
+		return
+	}
+
+	fmt.Printf("%-19s  %-10s  %-20s  %10s  %-8s  %9s  %s\n", "START", "DB", "SCRIPT", "DURATION", "STATUS", "BYTES", "ERRORS")
+
+	summaries := make(map[string]*scriptSummary)
+
+	var summaryKeys []string
+
+	for _, historyRecord := range historyRecords {
+		fmt.Printf("%-19s  %-10s  %-20s  %10s  %-8s  %9s  %s\n", historyRecord.Start.Local().Format("2006-01-02 15:04:05"), historyRecord.Database, historyRecord.Script,
+			formatDuration(historyRecord.Duration), historyRecord.Status, formatBytes(historyRecord.Bytes), strings.Join(historyRecord.Errors, ","))
+
+		summaryKey := historyRecord.Database + ":" + historyRecord.Script
+
+		summary, ok := summaries[summaryKey]
+		if ! ok {
+			summary = &scriptSummary{ Database: historyRecord.Database, Script: historyRecord.Script }
+			summaries[summaryKey] = summary
+			summaryKeys = append(summaryKeys, summaryKey)
+		}
+
+		if historyRecord.Status == "SKIPPED" {
+			summary.Skipped++
+			continue
+		}
+
+		summary.Runs++
+		summary.Duration += historyRecord.Duration
+
+		if historyRecord.Status == "SUCCESS" {
+			summary.Successes++
+		}
+	}
+
+	sort.Strings(summaryKeys)
+
+	fmt.Printf("\n%-10s  %-20s  %5s  %7s  %8s  %12s\n", "DB", "SCRIPT", "RUNS", "SKIPPED", "SUCCESS", "AVG DURATION")
+
+	for _, summaryKey := range summaryKeys {
+		summary := summaries[summaryKey]
+
+		// Skipped runs are not counted in the success rate or duration
+
+		if summary.Runs == 0 {
+			fmt.Printf("%-10s  %-20s  %5d  %7d  %8s  %12s\n", summary.Database, summary.Script, 0, summary.Skipped, "-", "-")
+			continue
+		}
+
+		fmt.Printf("%-10s  %-20s  %5d  %7d  %7.1f%%  %12s\n", summary.Database, summary.Script, summary.Runs, summary.Skipped,
+			float64(summary.Successes) * 100 / float64(summary.Runs), formatDuration(summary.Duration / float64(summary.Runs)))
+	}
+
+	logger.Info("Process complete")
+}
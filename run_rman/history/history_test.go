@@ -0,0 +1,98 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daviesluke/logger"
+)
+
+func writeStore(t *testing.T, historyRecords []logger.HistoryRecord) string {
+	storeName := filepath.Join(t.TempDir(), "run_rman.history")
+
+	var storeLines []string
+	for _, historyRecord := range historyRecords {
+		storeLine, err := json.Marshal(historyRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storeLines = append(storeLines, string(storeLine))
+	}
+	storeLines = append(storeLines, "not a history record")
+
+	if err := os.WriteFile(storeName, []byte(strings.Join(storeLines, "\n")+"\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return storeName
+}
+
+func TestMedian(t *testing.T) {
+	checks := []struct {
+		values   []float64
+		expected float64
+	}{
+		{[]float64{7}, 7},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+		{[]float64{100, 110, 90, 105, 1000}, 105},
+	}
+	for _, check := range checks {
+		values := append([]float64{}, check.values...)
+		if result := median(values); result != check.expected {
+			t.Fatalf("Median of %v is %v not %v", check.values, result, check.expected)
+		}
+		for i := range values {
+			if values[i] != check.values[i] {
+				t.Fatalf("Median changed the order of %v to %v", check.values, values)
+			}
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	start := time.Date(2026, 10, 1, 1, 0, 0, 0, time.UTC)
+
+	var historyRecords []logger.HistoryRecord
+	for i, duration := range []float64{100, 110, 90, 105, 1000} {
+		historyRecords = append(historyRecords, logger.HistoryRecord{Database: "ORCL", Script: "level0", Start: start.AddDate(0, 0, i), Duration: duration, Status: "SUCCESS"})
+	}
+	historyRecords = append(historyRecords,
+		logger.HistoryRecord{Database: "ORCL", Script: "level0", Start: start, Duration: 5, Status: "FAILURE"},
+		logger.HistoryRecord{Database: "ORCL", Script: "level0", Start: start, Duration: 1, Status: "SKIPPED"},
+		logger.HistoryRecord{Database: "ORCL", Script: "arch", Start: start, Duration: 10, Status: "SUCCESS"},
+		logger.HistoryRecord{Database: "TEST", Script: "level0", Start: start, Duration: 20, Status: "SUCCESS"},
+	)
+	storeName := writeStore(t, historyRecords)
+
+	// Spread is 1.4826 times the median distance from the median so the 1000 second run barely moves it
+	checks := []struct {
+		database string
+		maxRuns  int
+		median   time.Duration
+		spread   float64
+		runs     int
+	}{
+		{"ORCL", 10, 105 * time.Second, 1.4826 * 5, 5},
+		{"orcl", 10, 105 * time.Second, 1.4826 * 5, 5},
+		{"ORCL", 3, 105 * time.Second, 1.4826 * 15, 3},
+		{"TEST", 10, 20 * time.Second, 0, 1},
+		{"PROD", 10, 0, 0, 0},
+	}
+	for _, check := range checks {
+		medianDuration, spread, runs := Baseline(storeName, check.database, "level0", check.maxRuns)
+		if medianDuration != check.median || runs != check.runs {
+			t.Fatalf("Baseline for %s of %d runs is %s from %d runs not %s from %d", check.database, check.maxRuns, medianDuration, runs, check.median, check.runs)
+		}
+		if expected := time.Duration(check.spread * float64(time.Second)); (spread - expected).Abs() > time.Millisecond {
+			t.Fatalf("Spread for %s of %d runs is %s not %s", check.database, check.maxRuns, spread, expected)
+		}
+	}
+
+	if _, _, runs := Baseline(filepath.Join(t.TempDir(), "missing"), "ORCL", "level0", 10); runs != 0 {
+		t.Fatalf("Baseline from a missing store has %d runs", runs)
+	}
+}
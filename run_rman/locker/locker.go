@@ -4,8 +4,10 @@ package locker
 
 import "bufio"
 import "os"
+import "sort"
 import "strings"
 import "strconv"
+import "sync"
 import "time"
 
 // Local imports
@@ -15,89 +17,363 @@ import "github.com/daviesluke/logger"
 import "github.com/daviesluke/setup"
 import "github.com/daviesluke/utils"
 import "github.com/daviesluke/run_rman/config"
+import "github.com/daviesluke/run_rman/coordinator"
+import "github.com/daviesluke/run_rman/metrics"
 
 
 // local Variables
 
+//
+// Each line of a lock file is "PID NAME HOST LEASE STATE PRIORITY QUEUED"
+// LEASE is the unix time the entry expires unless renewed by its process
+// STATE is HELD or WAIT - waiters are served highest PRIORITY first then oldest QUEUED (unix nanoseconds)
+// Entries written before hosts were recorded only have "PID NAME" and are taken as local and held
+//
+
+type lockEntry struct {
+	PID      string
+	Name     string
+	Host     string
+	Lease    int64
+	Waiting  bool
+	Priority int
+	Queued   int64
+}
+
+// Closed to end lease renewal - nil when no renewer is running
+
+var leaseStop  chan struct{}
+var leaseMutex sync.Mutex
+
 // Local functions
 
-func checkLock( lockFileName string , lockName string , timeOutMins int ) {
-	var lockFile *os.File
-	var err      error
+func parseLockEntry (lockLine string) (lockEntry, bool) {
+	var entry lockEntry
 
-	logger.Debugf("Lock file -> %s", lockFileName)
-	logger.Debugf("Lock Name -> %s", lockName)
-	logger.Debugf("Time Out  -> %d mins", timeOutMins)
+	lockTokens := strings.Fields(lockLine)
 
-	// First check to see if file exists
+	if len(lockTokens) < 2 {
+		logger.Warnf("Ignoring malformed lock entry - %s", lockLine)
+		return entry, false
+	}
 
-	logger.Tracef("Attempting to open the file %s ...", lockFileName)
+	entry.PID  = lockTokens[0]
+	entry.Name = lockTokens[1]
 
-	if lockFile , err = os.Open(lockFileName); err == nil {
-		logger.Infof("File %s found. Checking contents ...", lockFileName)
+	if len(lockTokens) >= 4 {
+		entry.Host     = lockTokens[2]
+		entry.Lease, _ = strconv.ParseInt(lockTokens[3], 10, 64)
+	}
 
-		lockFile.Close()
-		logger.Debug("Closed the file")
+	if len(lockTokens) >= 7 {
+		entry.Waiting     = lockTokens[4] == "WAIT"
+		entry.Priority, _ = strconv.Atoi(lockTokens[5])
+		entry.Queued, _   = strconv.ParseInt(lockTokens[6], 10, 64)
+	}
 
-		CleanLockFile(lockFileName, lockName, 0)
+	return entry, true
+}
 
-		lockCounter := 0
-		logger.Debug("Initialized lock counter to zero")
+func (entry lockEntry) String() string {
+	lockState := "HELD"
+	if entry.Waiting {
+		lockState = "WAIT"
+	}
 
-		// File may now not exist after cleaning - try opening it again in loop
+	return strings.Join( []string{ entry.PID, entry.Name, entry.Host, strconv.FormatInt(entry.Lease, 10), lockState, strconv.Itoa(entry.Priority), strconv.FormatInt(entry.Queued, 10) }, " ")
+}
 
-		for {
-			lockFound := false
+func (entry lockEntry) isLocal() bool {
+	return entry.Host == "" || entry.Host == setup.HostName
+}
 
-			if lockFile , err = os.Open(lockFileName); err == nil {
-				logger.Debugf("Opened lock file %s", lockFileName)
+func (entry lockEntry) isOwn() bool {
+	return entry.PID == setup.CurrentPID && entry.isLocal()
+}
 
-				// Now let's read the lock file for the lock entry
-				lockScanner := bufio.NewScanner(lockFile)
-	
-				logger.Debug("Scanning file ...")
+func newLease() int64 {
+	leaseSecs, err := strconv.Atoi(config.ConfigValues["LeaseSecs"])
+	if err != nil {
+		logger.Errorf("LeaseSecs configuration is not an integer")
+	}
 
-				for lockScanner.Scan() {
-					variableTokens := strings.SplitN(lockScanner.Text(), " ", 2)
+	return time.Now().Unix() + int64(leaseSecs)
+}
 
-					lockPID, _  := strconv.Atoi(variableTokens[0])
-					fileLockName := variableTokens[1]
+func renewLeases (lockFileName string) {
+	logger.Debugf("Renewing leases in lock file %s ...", lockFileName)
 
-					logger.Debugf("Found PID %d with lock name %s", lockPID, fileLockName)
+	// Running alongside the main process so never exit on failure - the next renewal may work
 
-					if fileLockName == lockName {
-						logger.Warnf("Process %d has already locked this process using lock name %s!", lockPID, fileLockName)
-						lockFound = true
-						break
-					}
-				}
+	if ! filelock.TryLockFile(lockFileName,1) {
+		logger.Warnf("Unable to lock %s to renew lease", lockFileName)
+		return
+	}
 
-				// Close file
-				lockFile.Close()
-				logger.Debug("Lock File closed")
+	defer filelock.UnlockFile(lockFileName)
 
-				if lockFound {
-					lockCounter++
-					logger.Debugf("Lock counter incremented to %d", lockCounter)
-				}
-			} else {
-				logger.Debugf("Unable to open file %s", lockFileName)
+	lockFile, err := os.Open(lockFileName)
+	if err != nil {
+		logger.Debugf("Lock file %s no longer present", lockFileName)
+		return
+	}
+
+	var lockLines []string
+
+	lockScanner := bufio.NewScanner(lockFile)
+
+	for lockScanner.Scan() {
+		lockLine := lockScanner.Text()
+
+		if entry, ok := parseLockEntry(lockLine); ok && entry.isOwn() {
+			entry.Host  = setup.HostName
+			entry.Lease = newLease()
+			lockLine    = entry.String()
+		}
+
+		lockLines = append(lockLines, lockLine)
+	}
+
+	lockFile.Close()
+
+	if err := writeLockFile(lockFileName, "lease", lockLines); err != nil {
+		logger.Warnf("Unable to renew leases in %s - %s", lockFileName, err)
+	}
+
+	logger.Debug("Process complete")
+}
+
+func writeLockFile (lockFileName string, tempSuffix string, lockLines []string) error {
+	logger.Debugf("Rewriting lock file %s ...", lockFileName)
+
+	// Caller holds the file lock - write a copy and move it into place
+
+	tempFileName := strings.Join( []string{ lockFileName, setup.CurrentPID, tempSuffix }, ".")
+
+	if err := utils.WriteLines(tempFileName, lockLines); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempFileName, lockFileName); err != nil {
+		return err
+	}
+
+	logger.Debug("Process complete")
+
+	return nil
+}
+
+func startLeases (lockFileName string) {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+
+	if leaseStop != nil {
+		logger.Debug("Leases already being renewed")
+		return
+	}
+
+	leaseSecs, _ := strconv.Atoi(config.ConfigValues["LeaseSecs"])
+
+	// Renew well before the lease runs out so a slow file system does not make us look dead
+
+	renewInterval := time.Duration(leaseSecs) * time.Second / 3
+
+	if renewInterval <= 0 {
+		logger.Warn("LeaseSecs is not positive - leases will not be renewed")
+		return
+	}
+
+	leaseStop = make(chan struct{})
+
+	go keepLeases(lockFileName, renewInterval, leaseStop)
+}
+
+func stopLeases () {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+
+	if leaseStop != nil {
+		logger.Debug("Stopping lease renewal")
+		close(leaseStop)
+		leaseStop = nil
+	}
+}
+
+func keepLeases (lockFileName string, renewInterval time.Duration, stop chan struct{}) {
+	renewTicker := time.NewTicker(renewInterval)
+	defer renewTicker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-renewTicker.C:
+			renewLeases(lockFileName)
+		}
+	}
+}
+
+func coordinatorLock (lockName string, timeOut time.Duration) {
+	logger.Infof("Requesting lock %s from coordinator ...", lockName)
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	for attempt := 0; ; attempt++ {
+		gotLock, queuePosition, queueLength, lockHolder := coordinator.Lock(lockName)
+
+		if gotLock {
+			logger.Infof("Obtained lock %s", lockName)
+			break
+		}
+
+		if lockHolder != "" {
+			logger.Warnf("Process %s has already locked this process using lock name %s!", lockHolder, lockName)
+		}
+
+		logger.Infof("Waiting for lock %s - queue position %d of %d", lockName, queuePosition, queueLength)
+
+		// Nothing to watch for the coordinator so this is a plain back off
+
+		if ! utils.PollWait("", attempt, deadline, pollInterval, pollMax) {
+			logger.Errorf("Unable to obtain the lock %s. Exiting ...", lockName)
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+func takeLock( lockFileName string , lockName string ) (bool, int, int, string) {
+	logger.Debugf("Checking queue for lock %s ...", lockName)
+
+	var lockLines  []string
+	var lockQueue  []lockEntry
+
+	lockHolder := ""
+
+	// Read and update under the file lock so only one waiter can take the lock
+
+	filelock.LockFile(lockFileName,1)
+
+	if lockFile , err := os.Open(lockFileName); err == nil {
+		lockScanner := bufio.NewScanner(lockFile)
+
+		for lockScanner.Scan() {
+			lockLines = append(lockLines, lockScanner.Text())
+
+			entry, ok := parseLockEntry(lockScanner.Text())
+			if ! ok || entry.Name != lockName {
+				continue
 			}
 
-			if lockFound {
-				if lockCounter > timeOutMins {
-					logger.Errorf("Unable to obtain the lock %s. Exiting ...", lockName)
-				}
-				logger.Info("Sleeping for 60 seconds ...")
-				time.Sleep(60 * time.Second)
-			} else {
-				break
+			if entry.Waiting {
+				lockQueue = append(lockQueue, entry)
+			} else if ! entry.isOwn() {
+				lockHolder = strings.Join( []string{ entry.PID, entry.Host }, "@")
 			}
-		} 
+		}
+
+		lockFile.Close()
 	} else {
 		logger.Debugf("Unable to open file %s", lockFileName)
 	}
 
+	// Highest priority first and then first come first served
+
+	sort.SliceStable(lockQueue, func(i, j int) bool {
+		if lockQueue[i].Priority != lockQueue[j].Priority {
+			return lockQueue[i].Priority > lockQueue[j].Priority
+		}
+		return lockQueue[i].Queued < lockQueue[j].Queued
+	})
+
+	queuePosition := 0
+
+	for queueIndex, entry := range lockQueue {
+		if entry.isOwn() {
+			queuePosition = queueIndex + 1
+			break
+		}
+	}
+
+	gotLock := false
+
+	if lockHolder == "" && queuePosition == 1 {
+		logger.Debug("At head of queue and lock is free. Taking lock ...")
+
+		for lineIndex, lockLine := range lockLines {
+			if entry, ok := parseLockEntry(lockLine); ok && entry.isOwn() && entry.Name == lockName && entry.Waiting {
+				entry.Waiting = false
+				entry.Host    = setup.HostName
+				entry.Lease   = newLease()
+
+				lockLines[lineIndex] = entry.String()
+			}
+		}
+
+		if err := writeLockFile(lockFileName, "queue", lockLines); err != nil {
+			filelock.UnlockFile(lockFileName)
+			logger.Errorf("Unable to update lock file %s - %s", lockFileName, err)
+		}
+
+		gotLock = true
+	}
+
+	filelock.UnlockFile(lockFileName)
+
+	logger.Debug("Process complete")
+
+	return gotLock, queuePosition, len(lockQueue), lockHolder
+}
+
+func checkLock( lockFileName string , lockName string , timeOut time.Duration ) {
+	logger.Debugf("Lock file -> %s", lockFileName)
+	logger.Debugf("Lock Name -> %s", lockName)
+	logger.Debugf("Time Out  -> %s", timeOut)
+	logger.Debugf("Priority  -> %d", setup.Priority)
+
+	// Join the queue - the lock goes to the highest priority then the longest waiting
+
+	addEntry(lockFileName, lockEntry{ PID: setup.CurrentPID, Name: lockName, Host: setup.HostName, Lease: newLease(), Waiting: true, Priority: setup.Priority, Queued: time.Now().UnixNano() })
+
+	// Other hosts can only tell we are alive by the lease being kept up to date - waiting or not
+
+	startLeases(lockFileName)
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	for attempt := 0; ; attempt++ {
+		CleanLockFile(lockFileName, lockName, 0)
+
+		gotLock, queuePosition, queueLength, lockHolder := takeLock(lockFileName, lockName)
+
+		if gotLock {
+			logger.Infof("Obtained lock %s", lockName)
+			break
+		}
+
+		if queuePosition == 0 {
+			logger.Warnf("Queue entry for lock %s has been removed. Rejoining queue ...", lockName)
+			addEntry(lockFileName, lockEntry{ PID: setup.CurrentPID, Name: lockName, Host: setup.HostName, Lease: newLease(), Waiting: true, Priority: setup.Priority, Queued: time.Now().UnixNano() })
+		}
+
+		if lockHolder != "" {
+			logger.Warnf("Process %s has already locked this process using lock name %s!", lockHolder, lockName)
+		}
+
+		logger.Infof("Waiting for lock %s - queue position %d of %d", lockName, queuePosition, queueLength)
+
+		// Woken early if the lock file changes e.g. the holder releases the lock
+
+		if ! utils.PollWait(lockFileName, attempt, deadline, pollInterval, pollMax) {
+			RemoveLockEntry(lockFileName, setup.CurrentPID, setup.HostName)
+			logger.Errorf("Unable to obtain the lock %s. Exiting ...", lockName)
+		}
+	}
+
 	logger.Debug("Process complete")
 }
 
@@ -110,13 +386,25 @@ func LockProcess (lockName, database string) {
 	// Reset the number of minutes to wait before locking process
 
 	if lockName != "" {
-		checkLockMins, _ := strconv.Atoi(config.ConfigValues["CheckLockMins"])
+		// Lock file entries and coordinator requests are split on white space
+
+		if strings.ContainsAny(lockName, " \t") {
+			logger.Errorf("Lock name %q cannot contain spaces", lockName)
+		}
 
-		checkLock(setup.LockFileName, lockName, checkLockMins)
+		checkLockTimeout := config.GetTimeout("CheckLockTimeout", "CheckLockMins")
 
-		// If we get to here then add the entry 
+		metrics.StartWait("lock")
 
-		AddLockEntry(setup.LockFileName, setup.CurrentPID,  lockName)
+		if coordinator.Enabled() {
+			coordinatorLock(lockName, checkLockTimeout)
+		} else {
+			// Returns once our queue entry has become the lock holder
+
+			checkLock(setup.LockFileName, lockName, checkLockTimeout)
+		}
+
+		metrics.EndWait("lock")
 	} else {
 		logger.Info("No lock string provided. No locking necessary")
 	}
@@ -124,9 +412,23 @@ func LockProcess (lockName, database string) {
 	logger.Info("Process complete")
 }
 
-func RemoveLockEntry(lockFileName string, lockPID string) {
+func UnlockProcess (lockName string) {
+	logger.Infof("Unlocking process lock %s ...", lockName)
+
+	if coordinator.Enabled() {
+		coordinator.Unlock(lockName)
+	} else {
+		stopLeases()
+		RemoveLockEntry(setup.LockFileName, setup.CurrentPID, setup.HostName)
+	}
+
+	logger.Info("Process complete")
+}
+
+func RemoveLockEntry(lockFileName string, lockPID string, lockHost string) {
 	logger.Infof("Lock File : %s", lockFileName)
 	logger.Infof("Lock PID  : %s", lockPID)
+	logger.Infof("Lock Host : %s", lockHost)
 
 	// To write the file - take a real lock
 	
@@ -145,12 +447,15 @@ func RemoveLockEntry(lockFileName string, lockPID string) {
 			lockScanner := bufio.NewScanner(lockFile)
 
 			for lockScanner.Scan() {
-				variableTokens := strings.SplitN(lockScanner.Text(), " ", 2)
-				
-				fileLockPID := variableTokens[0]
+				entry, ok := parseLockEntry(lockScanner.Text())
 
-				if fileLockPID != lockPID {
-					logger.Debugf("Found PID %s for writing ...", fileLockPID)
+				fileLockHost := entry.Host
+				if fileLockHost == "" {
+					fileLockHost = setup.HostName
+				}
+
+				if ! ok || entry.PID != lockPID || fileLockHost != lockHost {
+					logger.Debugf("Found PID %s on host %s for writing ...", entry.PID, fileLockHost)
 					if bytesWritten, err := newLockFile.WriteString(lockScanner.Text()+"\n"); err != nil {
 						filelock.UnlockFile(lockFileName)
 						logger.Errorf("Unable to write to new lock file %s", newLockFileName)
@@ -159,7 +464,7 @@ func RemoveLockEntry(lockFileName string, lockPID string) {
 						logger.Debugf("Written %d bytes to new lock file, %d written so far", bytesWritten, fileWriteSize)
 					}
 				} else {
-					logger.Debugf("Ignoring PID %s ...", fileLockPID)
+					logger.Debugf("Ignoring PID %s on host %s ...", entry.PID, fileLockHost)
 				}
 			}
 
@@ -214,48 +519,60 @@ func RemoveLockEntry(lockFileName string, lockPID string) {
 func CleanLockFile(lockFileName string, lockName string, startingEntry int) []string {
 	logger.Info("Cleaning lock file of dead processes ...")
 
-	var lockPIDS []string
+	var lockPIDS    []string
+	var staleLocks  []lockEntry
 
-	lockCount := 0
 	lineCount := 0
 
 	if lockFile , err := os.Open(lockFileName); err == nil {
 		lockScanner := bufio.NewScanner(lockFile)
 
 		for lockScanner.Scan() {
-			variableTokens := strings.SplitN(lockScanner.Text(), " ", 2)
+			entry, ok := parseLockEntry(lockScanner.Text())
+			if ! ok {
+				lineCount++
+				continue
+			}
 
-			lockPID       := variableTokens[0]
+			if ! entry.isOwn() {
+				ilockPID, _  := strconv.Atoi(entry.PID)
 
-			if lockPID != setup.CurrentPID {
-				ilockPID, _   := strconv.Atoi(variableTokens[0])
-				fileLockName := variableTokens[1]
+				if entry.Name == lockName {
+					if ! entry.isLocal() {
+						// Cannot see processes on other hosts so rely on the lease
 
-				if fileLockName == lockName {
-					logger.Debugf("Found PID with lock name %s. Checking PID %d is still alive ...", fileLockName, ilockPID)
+						logger.Debugf("Found PID %d on host %s with lock name %s. Checking lease ...", ilockPID, entry.Host, entry.Name)
 
-					if pidAlive, pidIsName := utils.CheckProcess(ilockPID, setup.BaseName); pidAlive {
-						if pidIsName {
-							logger.Infof("Process %d is running %s.  Valid entry", ilockPID, setup.BaseName)
+						if time.Now().Unix() > entry.Lease {
+							logger.Warnf("Process %d on host %s has not renewed its lease since %s. Removing ...", ilockPID, entry.Host, time.Unix(entry.Lease, 0).Format("2006-01-02 15:04:05"))
+
+							staleLocks = append(staleLocks,entry)
 						} else {
-							if lineCount >= startingEntry {
-								logger.Warnf("Process %d is not running %s. Invalid entry. Removing ...", ilockPID, setup.BaseName)
+							logger.Infof("Process %d on host %s holds a current lease.  Valid entry", ilockPID, entry.Host)
+						}
+					} else {
+						logger.Debugf("Found PID with lock name %s. Checking PID %d is still alive ...", entry.Name, ilockPID)
 
-							
-								lockPIDS = append(lockPIDS,lockPID)
-								lockCount++
+						if pidAlive, pidIsName := utils.CheckProcess(ilockPID, setup.BaseName); pidAlive {
+							if pidIsName {
+								logger.Infof("Process %d is running %s.  Valid entry", ilockPID, setup.BaseName)
 							} else {
-								logger.Warnf("Process %d is not running %s. But is at line %d in lock file. Keeping ...", ilockPID, setup.BaseName)
+								if lineCount >= startingEntry {
+									logger.Warnf("Process %d is not running %s. Invalid entry. Removing ...", ilockPID, setup.BaseName)
+
+									staleLocks = append(staleLocks,entry)
+								} else {
+									logger.Warnf("Process %d is not running %s. But is at line %d in lock file. Keeping ...", ilockPID, setup.BaseName, lineCount)
+								}
 							}
-						}
-					} else {
-						logger.Warnf("Old PID %d found in lock file and is no longer running. Removing ...", ilockPID)
+						} else {
+							logger.Warnf("Old PID %d found in lock file and is no longer running. Removing ...", ilockPID)
 
-						lockPIDS = append(lockPIDS,lockPID)
-						lockCount++
+							staleLocks = append(staleLocks,entry)
+						}
 					}
 				} else {
-					logger.Debugf("Found PID %d for lock name %s", ilockPID, fileLockName)
+					logger.Debugf("Found PID %d for lock name %s", ilockPID, entry.Name)
 				}
 			} else {
 				logger.Debug("PID found is current PID.  Ignoring ...")
@@ -272,9 +589,16 @@ func CleanLockFile(lockFileName string, lockName string, startingEntry int) []st
 
 	// Remove any PIDs found
 
-	for lockCounter := 0; lockCounter < lockCount; lockCounter++ {
-		logger.Debugf("Removing %s from lock file", lockPIDS[lockCounter])
-		RemoveLockEntry(lockFileName, lockPIDS[lockCounter])
+	for _, entry := range staleLocks {
+		lockHost := entry.Host
+		if lockHost == "" {
+			lockHost = setup.HostName
+		}
+
+		logger.Debugf("Removing %s on host %s from lock file", entry.PID, lockHost)
+		RemoveLockEntry(lockFileName, entry.PID, lockHost)
+
+		lockPIDS = append(lockPIDS, entry.PID)
 	}
 
 	logger.Info("Process complete")
@@ -285,12 +609,20 @@ func CleanLockFile(lockFileName string, lockName string, startingEntry int) []st
 func AddLockEntry(lockFileName, pid, lockName string) {
 	logger.Debug("Adding lock entry ...")
 
+	addEntry(lockFileName, lockEntry{ PID: pid, Name: lockName, Host: setup.HostName, Lease: newLease(), Priority: setup.Priority, Queued: time.Now().UnixNano() })
+
+	logger.Debug("Process complete")
+}
+
+func addEntry(lockFileName string, entry lockEntry) {
+	logger.Debug("Writing lock entry ...")
+
 	// To write the file - take a real lock
 	
 	filelock.LockFile(lockFileName,1)
 
 	if lockFile, err := os.OpenFile(lockFileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
-		writeString := strings.Join( []string{ pid, " ", lockName }, "")
+		writeString := entry.String()
 	
 		if _, err := lockFile.WriteString(writeString+"\n"); err != nil {
 			filelock.UnlockFile(lockFileName)
@@ -0,0 +1,207 @@
+package metrics
+
+// Standard imports
+
+import "bufio"
+import "fmt"
+import "os"
+import "path/filepath"
+import "regexp"
+import "strconv"
+import "strings"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/run_rman/config"
+
+// local variables
+
+//
+// After each run a node_exporter textfile collector file run_rman_<DB>_<SCRIPT>.prom
+// is written to MetricsDir. Values carried between runs such as the last success
+// time and the error total are read back from the previous file
+//
+
+var waitStarts = make(map[string]time.Time)
+var waitTimes  = make(map[string]time.Duration)
+
+var metricHelp = []struct {
+	Name string
+	Help string
+}{
+	{ "run_rman_last_run_timestamp",       "Unix time the last run finished" },
+	{ "run_rman_last_success_timestamp",   "Unix time the last successful run finished" },
+	{ "run_rman_last_duration_seconds",    "Duration of the last run" },
+	{ "run_rman_last_status",              "1 if the last run succeeded otherwise 0" },
+	{ "run_rman_last_bytes",               "Bytes backed up by the last run" },
+	{ "run_rman_lock_wait_seconds",        "Time the last run waited for its lock" },
+	{ "run_rman_resource_wait_seconds",    "Time the last run waited for its resources" },
+	{ "run_rman_rman_errors_total",        "RMAN and ORA error codes reported over all runs" },
+}
+
+// local functions
+
+func labelValue ( value string ) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func waitSeconds ( waitName string ) float64 {
+	waitTime := waitTimes[waitName]
+
+	// Still waiting if the run failed while waiting
+
+	if waitStart, ok := waitStarts[waitName]; ok {
+		waitTime += time.Since(waitStart)
+	}
+
+	return waitTime.Seconds()
+}
+
+func readPrevious ( metricsFileName string ) map[string]float64 {
+	logger.Debugf("Reading previous metrics from %s ...", metricsFileName)
+
+	previousValues := make(map[string]float64)
+
+	metricsFile, err := os.Open(metricsFileName)
+	if err != nil {
+		logger.Debugf("No previous metrics file %s", metricsFileName)
+		return previousValues
+	}
+
+	defer metricsFile.Close()
+
+	metricsScanner := bufio.NewScanner(metricsFile)
+
+	for metricsScanner.Scan() {
+		metricsLine := metricsScanner.Text()
+
+		if metricsLine == "" || metricsLine[0] == '#' {
+			continue
+		}
+
+		// Lines are name{labels} value
+
+		nameEnd   := strings.IndexAny(metricsLine, "{ ")
+		valueFrom := strings.LastIndex(metricsLine, " ")
+
+		if nameEnd <= 0 || valueFrom <= 0 {
+			continue
+		}
+
+		if metricValue, err := strconv.ParseFloat(metricsLine[valueFrom+1:], 64); err == nil {
+			previousValues[metricsLine[:nameEnd]] = metricValue
+		}
+	}
+
+	logger.Debug("Process complete")
+
+	return previousValues
+}
+
+// Global functions
+
+func StartWait ( waitName string ) {
+	waitStarts[waitName] = time.Now()
+}
+
+func EndWait ( waitName string ) {
+	if waitStart, ok := waitStarts[waitName]; ok {
+		waitTimes[waitName] += time.Since(waitStart)
+
+		delete(waitStarts, waitName)
+	}
+}
+
+func WriteMetrics ( historyRecord logger.HistoryRecord ) {
+	logger.Info("Writing metrics ...")
+
+	metricsDir := config.ConfigValues["MetricsDir"]
+
+	if metricsDir == "" {
+		logger.Debug("No metrics directory set")
+		return
+	}
+
+	// A skipped run leaves the last run's metrics as they were
+
+	if historyRecord.Status == "SKIPPED" {
+		logger.Debug("Run skipped - metrics unchanged")
+		return
+	}
+
+	// Errors are only warned about here as this also runs while failing
+
+	safeName := regexp.MustCompile("[^A-Za-z0-9_]")
+
+	metricsFileName := strings.Join( []string{ "run_rman", safeName.ReplaceAllString(historyRecord.Database, "_"), safeName.ReplaceAllString(historyRecord.Script, "_") }, "_") + ".prom"
+	metricsFileName  = filepath.Join(metricsDir, metricsFileName)
+
+	previousValues := readPrevious(metricsFileName)
+
+	metricValues := map[string]float64{
+		"run_rman_last_run_timestamp":     float64(historyRecord.End.Unix()),
+		"run_rman_last_success_timestamp": previousValues["run_rman_last_success_timestamp"],
+		"run_rman_last_duration_seconds":  historyRecord.Duration,
+		"run_rman_last_status":            0,
+		"run_rman_last_bytes":             float64(historyRecord.Bytes),
+		"run_rman_lock_wait_seconds":      waitSeconds("lock"),
+		"run_rman_resource_wait_seconds":  waitSeconds("resource"),
+		"run_rman_rman_errors_total":      previousValues["run_rman_rman_errors_total"] + float64(len(historyRecord.Errors)),
+	}
+
+	if historyRecord.Status == "SUCCESS" {
+		metricValues["run_rman_last_success_timestamp"] = float64(historyRecord.End.Unix())
+		metricValues["run_rman_last_status"] = 1
+	}
+
+	labels := fmt.Sprintf(`{db="%s",script="%s"}`, labelValue(historyRecord.Database), labelValue(historyRecord.Script))
+
+	var metricsText strings.Builder
+
+	for _, metric := range metricHelp {
+		metricType := "gauge"
+
+		if strings.HasSuffix(metric.Name, "_total") {
+			metricType = "counter"
+		}
+
+		fmt.Fprintf(&metricsText, "# HELP %s %s\n# TYPE %s %s\n%s%s %s\n", metric.Name, metric.Help, metric.Name, metricType,
+			metric.Name, labels, strconv.FormatFloat(metricValues[metric.Name], 'f', -1, 64))
+	}
+
+	// Write a hidden temporary file and rename it so the collector never reads a partial file
+
+	tmpFileName := filepath.Join(metricsDir, "." + filepath.Base(metricsFileName) + "." + strconv.Itoa(os.Getpid()))
+
+	tmpFile, err := os.OpenFile(tmpFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		logger.Warnf("Unable to open metrics file %s - %s", tmpFileName, err)
+		return
+	}
+
+	_, err = tmpFile.WriteString(metricsText.String())
+
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFileName, metricsFileName)
+	}
+
+	if err != nil {
+		os.Remove(tmpFileName)
+		logger.Warnf("Unable to write metrics file %s - %s", metricsFileName, err)
+		return
+	}
+
+	logger.Debugf("Metrics written to %s", metricsFileName)
+
+	logger.Debug("Process complete")
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daviesluke/logger"
+	"github.com/daviesluke/run_rman/config"
+)
+
+func TestReadPrevious(t *testing.T) {
+	metricsFileName := filepath.Join(t.TempDir(), "run_rman_ORCL_level0.prom")
+	metricsLines := strings.Join([]string{
+		"# HELP run_rman_last_status 1 if the last run succeeded otherwise 0",
+		"# TYPE run_rman_last_status gauge",
+		`run_rman_last_status{db="ORCL",script="level 0"} 1`,
+		`run_rman_last_success_timestamp{db="ORCL",script="level0"} 1790000000`,
+		"run_rman_rman_errors_total 3",
+		"",
+		"run_rman_last_bytes not_a_number",
+		"{} 5",
+	}, "\n")
+	if err := os.WriteFile(metricsFileName, []byte(metricsLines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previousValues := readPrevious(metricsFileName)
+	expected := map[string]float64{
+		"run_rman_last_status":            1,
+		"run_rman_last_success_timestamp": 1790000000,
+		"run_rman_rman_errors_total":      3,
+	}
+	if len(previousValues) != len(expected) {
+		t.Fatalf("Read %v not %v", previousValues, expected)
+	}
+	for name, value := range expected {
+		if previousValues[name] != value {
+			t.Fatalf("Read %s as %v not %v", name, previousValues[name], value)
+		}
+	}
+
+	if previousValues := readPrevious(metricsFileName + ".missing"); len(previousValues) != 0 {
+		t.Fatalf("Read %v from a missing file", previousValues)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	metricsDir := t.TempDir()
+	config.ConfigValues["MetricsDir"] = metricsDir
+
+	end := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	metricsFileName := filepath.Join(metricsDir, "run_rman_ORCL_level_0.prom")
+
+	checks := []struct {
+		historyRecord logger.HistoryRecord
+		expected      []string
+	}{
+		{
+			logger.HistoryRecord{Database: "ORCL", Script: "level-0", End: end, Duration: 95.5, Status: "SUCCESS", Bytes: 1024},
+			[]string{
+				`run_rman_last_run_timestamp{db="ORCL",script="level-0"} 1792288800`,
+				`run_rman_last_success_timestamp{db="ORCL",script="level-0"} 1792288800`,
+				`run_rman_last_duration_seconds{db="ORCL",script="level-0"} 95.5`,
+				`run_rman_last_status{db="ORCL",script="level-0"} 1`,
+				`run_rman_last_bytes{db="ORCL",script="level-0"} 1024`,
+				`run_rman_rman_errors_total{db="ORCL",script="level-0"} 0`,
+				"# TYPE run_rman_rman_errors_total counter",
+				"# TYPE run_rman_last_status gauge",
+			},
+		},
+		{
+			// A failure keeps the last success time and adds its errors to the total
+			logger.HistoryRecord{Database: "ORCL", Script: "level-0", End: end.Add(time.Hour), Duration: 10, Status: "FAILURE", Errors: []string{"RMAN-03009", "ORA-19502"}},
+			[]string{
+				`run_rman_last_run_timestamp{db="ORCL",script="level-0"} 1792292400`,
+				`run_rman_last_success_timestamp{db="ORCL",script="level-0"} 1792288800`,
+				`run_rman_last_status{db="ORCL",script="level-0"} 0`,
+				`run_rman_rman_errors_total{db="ORCL",script="level-0"} 2`,
+			},
+		},
+		{
+			// A skipped run leaves the file alone
+			logger.HistoryRecord{Database: "ORCL", Script: "level-0", End: end.Add(2 * time.Hour), Status: "SKIPPED", Errors: []string{"RMAN-00000"}},
+			[]string{
+				`run_rman_last_run_timestamp{db="ORCL",script="level-0"} 1792292400`,
+				`run_rman_rman_errors_total{db="ORCL",script="level-0"} 2`,
+			},
+		},
+		{
+			logger.HistoryRecord{Database: "ORCL", Script: "level-0", End: end.Add(3 * time.Hour), Status: "FAILURE", Errors: []string{"ORA-00001"}},
+			[]string{
+				`run_rman_rman_errors_total{db="ORCL",script="level-0"} 3`,
+			},
+		},
+	}
+	for checkNo, check := range checks {
+		WriteMetrics(check.historyRecord)
+
+		metricsText, err := os.ReadFile(metricsFileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, metricsLine := range check.expected {
+			if !strings.Contains(string(metricsText), metricsLine+"\n") {
+				t.Fatalf("Check %d metrics do not contain %q:\n%s", checkNo, metricsLine, metricsText)
+			}
+		}
+
+		// Only the renamed file is left behind
+		if entries, err := os.ReadDir(metricsDir); err != nil || len(entries) != 1 {
+			t.Fatalf("Metrics directory holds %v - %v", entries, err)
+		}
+	}
+}
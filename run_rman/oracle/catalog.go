@@ -0,0 +1,171 @@
+package oracle
+
+// Standard imports
+
+import "database/sql"
+import "fmt"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/run_rman/config"
+
+// local variables
+
+// local functions
+
+func nullText ( value sql.NullString ) string {
+	if ! value.Valid {
+		return "never"
+	}
+
+	return value.String
+}
+
+func targetDBID ( db *sql.DB ) int64 {
+	logger.Debug("Getting target DBID ...")
+
+	var dbid int64
+
+	if err := db.QueryRow("select dbid from v$database").Scan(&dbid); err != nil {
+		logger.Errorf("Unable to get the DBID of database %s - %s", setup.Database, err)
+	}
+
+	logger.Debugf("DBID %d", dbid)
+
+	logger.Debug("Process complete")
+
+	return dbid
+}
+
+// Global functions
+
+func Registered () bool {
+	logger.Debug("Checking database is in the catalog ...")
+
+	targetDB, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to database %s", setup.Database)
+	}
+
+	defer targetDB.Close()
+
+	catalogDB, err := sql.Open("oci8", catalogDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to the catalog")
+	}
+
+	defer catalogDB.Close()
+
+	var registered int
+
+	if err := catalogDB.QueryRow("select count(*) from rc_database where dbid = :1", targetDBID(targetDB)).Scan(&registered); err != nil {
+		logger.Errorf("Unable to check the catalog for database %s - %s", setup.Database, err)
+	}
+
+	logger.Debug("Process complete")
+
+	return registered > 0
+}
+
+func CatalogHealth () bool {
+	logger.Info("Checking catalog health ...")
+
+	if config.ConfigValues["CatalogConnection"] == "" {
+		logger.Errorf("No CatalogConnection configured")
+	}
+
+	maxLag := config.GetDuration("CatalogMaxLag", time.Hour)
+
+	targetDB, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to database %s", setup.Database)
+	}
+
+	defer targetDB.Close()
+
+	catalogDB, err := sql.Open("oci8", catalogDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to the catalog")
+	}
+
+	defer catalogDB.Close()
+
+	// The target's control file shows what the catalog should have caught up to
+
+	dbid := targetDBID(targetDB)
+
+	var controlfileBackup sql.NullString
+
+	if err := targetDB.QueryRow("select to_char(max(completion_time),'YYYY/MM/DD HH24:MI:SS') from v$backup_set").Scan(&controlfileBackup); err != nil {
+		logger.Errorf("Unable to get the last backup from the control file - %s", err)
+	}
+
+	catalogQuery := `select d.name, d.dbid,
+	                        (select to_char(max(r.resync_time),'YYYY/MM/DD HH24:MI:SS') from rc_resync r where r.db_key = d.db_key),
+	                        (select to_char(max(s.completion_time),'YYYY/MM/DD HH24:MI:SS') from rc_backup_set s where s.db_key = d.db_key)
+	                 from rc_database d
+	                 order by d.name`
+
+	catalogRows, err := catalogDB.Query(catalogQuery)
+	if err != nil {
+		logger.Errorf("Unable to read the catalog - %s", err)
+	}
+
+	defer catalogRows.Close()
+
+	unhealthy   := false
+	targetFound := false
+
+	fmt.Printf("%-10s  %12s  %-19s  %-19s  %s\n", "DB", "DBID", "LAST RESYNC", "LAST BACKUP", "RESULT")
+
+	for catalogRows.Next() {
+		var dbName       string
+		var catalogDBID  int64
+		var lastResync   sql.NullString
+		var lastBackup   sql.NullString
+
+		if err := catalogRows.Scan(&dbName, &catalogDBID, &lastResync, &lastBackup); err != nil {
+			logger.Errorf("Unable to read the catalog - %s", err)
+		}
+
+		catalogResult := "OK"
+
+		// Resync is also done by every backup connected to the catalog so an old one means it is not being used
+
+		if resyncTime, ok := reportTime(lastResync); ! ok || time.Since(resyncTime) > maxLag {
+			catalogResult = "STALE"
+		}
+
+		if catalogDBID == dbid {
+			targetFound = true
+
+			controlfileTime, controlfileOK := reportTime(controlfileBackup)
+			catalogTime, catalogOK         := reportTime(lastBackup)
+
+			if controlfileOK && ( ! catalogOK || controlfileTime.After(catalogTime) ) {
+				catalogResult = "BEHIND - control file has backups to " + controlfileBackup.String
+			}
+		}
+
+		if catalogResult != "OK" {
+			unhealthy = true
+		}
+
+		fmt.Printf("%-10s  %12d  %-19s  %-19s  %s\n", dbName, catalogDBID, nullText(lastResync), nullText(lastBackup), catalogResult)
+	}
+
+	if ! targetFound {
+		fmt.Printf("\nDatabase %s (DBID %d) is not registered in the catalog\n", setup.Database, dbid)
+		unhealthy = true
+	}
+
+	logger.Infof("Catalog unhealthy %t", unhealthy)
+
+	logger.Info("Process complete")
+
+	return unhealthy
+}
+
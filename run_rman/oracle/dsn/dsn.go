@@ -0,0 +1,219 @@
+package dsn
+
+// Standard imports
+
+import "errors"
+import "fmt"
+import "strings"
+
+// local variables
+
+//
+// Connections are written as they would be for RMAN or SQL*Plus
+//
+//   /                          operating system authentication
+//   /@ALIAS                    wallet (external password store) alias
+//   user/password@alias        password may be in double quotes if it holds @ or /
+//   ... as sysbackup           role - SYSDBA, SYSBACKUP, SYSOPER or SYSASM
+//
+// and turned into a go-oci8 DSN or an RMAN connect string
+//
+
+type Connection struct {
+	User     string
+	Password string
+	Alias    string
+	Role     string
+}
+
+var roles = map[string]bool {
+	"SYSDBA"    : true,
+	"SYSBACKUP" : true,
+	"SYSOPER"   : true,
+	"SYSASM"    : true,
+}
+
+// local functions
+
+func escape ( value string, special string ) string {
+	var escaped strings.Builder
+
+	for _, char := range []byte(value) {
+		if char == '%' || strings.IndexByte(special, char) >= 0 {
+			fmt.Fprintf(&escaped, "%%%02X", char)
+		} else {
+			escaped.WriteByte(char)
+		}
+	}
+
+	return escaped.String()
+}
+
+func needsQuote ( char rune ) bool {
+	return ! ( char >= 'A' && char <= 'Z' || char >= 'a' && char <= 'z' || char >= '0' && char <= '9' || char == '_' || char == '$' || char == '#' )
+}
+
+// Global functions
+
+func Parse ( connString string ) ( Connection, error ) {
+	var connection Connection
+
+	connString = strings.TrimSpace(connString)
+
+	if connString == "" {
+		return connection, errors.New("empty connection")
+	}
+
+	// Role on the end e.g. / as sysdba - single or double quotes around the whole string are allowed
+
+	for _, quote := range []string{ "'", "\"" } {
+		if len(connString) > 1 && strings.HasPrefix(connString, quote) && strings.HasSuffix(connString, quote) && strings.Count(connString, quote) == 2 {
+			connString = strings.TrimSpace(connString[1:len(connString)-1])
+		}
+	}
+
+	if fields := strings.Fields(connString); len(fields) >= 3 && strings.EqualFold(fields[len(fields)-2], "as") {
+		connection.Role = strings.ToUpper(fields[len(fields)-1])
+
+		if ! roles[connection.Role] {
+			return connection, fmt.Errorf("invalid role %s - must be SYSDBA, SYSBACKUP, SYSOPER or SYSASM", fields[len(fields)-1])
+		}
+
+		connString = strings.TrimSpace(connString[:strings.LastIndex(strings.ToLower(connString), " as ")])
+	}
+
+	// User up to the first / then a password which may be quoted then @alias
+
+	userEnd := strings.IndexAny(connString, "/@")
+
+	if userEnd < 0 {
+		connection.User = connString
+		return connection, nil
+	}
+
+	connection.User = connString[:userEnd]
+	connString      = connString[userEnd:]
+
+	if strings.HasPrefix(connString, "/") {
+		connString = connString[1:]
+
+		if strings.HasPrefix(connString, "\"") {
+			quoteEnd := strings.Index(connString[1:], "\"")
+			if quoteEnd < 0 {
+				return connection, errors.New("password quote not closed")
+			}
+
+			connection.Password = connString[1:quoteEnd+1]
+			connString          = connString[quoteEnd+2:]
+		} else if aliasStart := strings.LastIndex(connString, "@"); aliasStart >= 0 {
+			connection.Password = connString[:aliasStart]
+			connString          = connString[aliasStart:]
+		} else {
+			connection.Password = connString
+			connString          = ""
+		}
+	}
+
+	if strings.HasPrefix(connString, "@") {
+		connection.Alias = connString[1:]
+	} else if connString != "" {
+		return connection, fmt.Errorf("unexpected %s after the password", connString)
+	}
+
+	if connection.User == "" && connection.Password != "" {
+		return connection, errors.New("password given without a user")
+	}
+
+	// Oracle does not allow a double quote in a password and RMAN could not be given one
+
+	if strings.Contains(connection.Password, "\"") {
+		return connection, errors.New("password cannot contain a double quote")
+	}
+
+	// With a role RMAN is given the whole connection in single quotes
+
+	if connection.Role != "" && strings.Contains(connection.Password, "'") {
+		return connection, errors.New("password cannot contain a single quote when a role is given")
+	}
+
+	return connection, nil
+}
+
+func (connection Connection) External () bool {
+	return connection.User == "" && connection.Password == ""
+}
+
+func (connection Connection) OCI8 ( defaultRole string ) string {
+	// user/password@alias?as=role with / @ ? : and % escaped as the driver unescapes them
+
+	oci8DSN := escape(connection.User, "@/?:")
+
+	if connection.Password != "" || connection.External() {
+		oci8DSN += "/" + escape(connection.Password, "@/?:")
+	}
+
+	oci8DSN += "@" + escape(connection.Alias, "?")
+
+	role := connection.Role
+
+	if role == "" {
+		role = defaultRole
+	}
+
+	if role != "" {
+		oci8DSN += "?as=" + strings.ToLower(role)
+	}
+
+	return oci8DSN
+}
+
+func (connection Connection) RMAN () string {
+	// The password needs quotes unless it is only characters RMAN reads as part of a name
+	// e.g. ; would end the connect command
+
+	rmanConnection := connection.User
+
+	if connection.Password != "" || connection.External() {
+		password := connection.Password
+
+		if strings.IndexFunc(password, needsQuote) >= 0 {
+			password = "\"" + password + "\""
+		}
+
+		rmanConnection += "/" + password
+	}
+
+	if connection.Alias != "" {
+		rmanConnection += "@" + connection.Alias
+	}
+
+	// With a role the whole string is quoted, in single quotes so a quoted password still works
+
+	if connection.Role != "" {
+		rmanConnection = "'" + rmanConnection + " as " + strings.ToLower(connection.Role) + "'"
+	}
+
+	return rmanConnection
+}
+
+func (connection Connection) String () string {
+	// For logging - never shows the password
+
+	displayConnection := connection.User
+
+	if connection.Password != "" {
+		displayConnection += "/*****"
+	} else if connection.External() {
+		displayConnection += "/"
+	}
+
+	if connection.Alias != "" {
+		displayConnection += "@" + connection.Alias
+	}
+
+	if connection.Role != "" {
+		displayConnection += " as " + strings.ToLower(connection.Role)
+	}
+
+	return displayConnection
+}
@@ -0,0 +1,92 @@
+package dsn
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	checks := map[string]Connection{
+		"/":                         {},
+		"/@ORCL_BACKUP":             {Alias: "ORCL_BACKUP"},
+		"/ as sysbackup":            {Role: "SYSBACKUP"},
+		"sys/secret@ORCL AS SYSDBA": {User: "sys", Password: "secret", Alias: "ORCL", Role: "SYSDBA"},
+		"rman/\"p@ss/word\"@RCAT":   {User: "rman", Password: "p@ss/word", Alias: "RCAT"},
+		"'c##bkp/secret@db:1521/orcl as sysbackup'": {User: "c##bkp", Password: "secret", Alias: "db:1521/orcl", Role: "SYSBACKUP"},
+		"\"bkp/secret@db:1521/orcl as sysbackup\"":  {User: "bkp", Password: "secret", Alias: "db:1521/orcl", Role: "SYSBACKUP"},
+		"system/secret":   {User: "system", Password: "secret"},
+		"scott@ORCL":      {User: "scott", Alias: "ORCL"},
+		"user/pa@ss@ORCL": {User: "user", Password: "pa@ss", Alias: "ORCL"},
+	}
+	for connString, expected := range checks {
+		connection, err := Parse(connString)
+		if err != nil {
+			t.Fatalf("Parse %q failed - %v", connString, err)
+		}
+		if connection != expected {
+			t.Fatalf("Parse %q gave %+v not %+v", connString, connection, expected)
+		}
+	}
+	for _, connString := range []string{"", "/ as sysfoo", "/secret@ORCL", "rman/\"secret@RCAT", "user/\"secret\"x", "user/pa\"ss@ORCL"} {
+		if _, err := Parse(connString); err == nil {
+			t.Fatalf("Parse %q accepted", connString)
+		}
+	}
+}
+
+func TestOCI8(t *testing.T) {
+	checks := []struct {
+		connString  string
+		defaultRole string
+		expected    string
+	}{
+		{"/", "SYSDBA", "/@?as=sysdba"},
+		{"/@ORCL_BACKUP", "SYSDBA", "/@ORCL_BACKUP?as=sysdba"},
+		{"/@ORCL_BACKUP as sysbackup", "SYSDBA", "/@ORCL_BACKUP?as=sysbackup"},
+		{"sys/secret@ORCL", "SYSDBA", "sys/secret@ORCL?as=sysdba"},
+		{"sys/secret", "SYSDBA", "sys/secret@?as=sysdba"},
+		{"rman/\"p@ss/w:d%?\"@RCAT", "", "rman/p%40ss%2Fw%3Ad%25%3F@RCAT"},
+		{"scott@db:1521/orcl", "", "scott@db:1521/orcl"},
+	}
+	for _, check := range checks {
+		connection, err := Parse(check.connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oci8DSN := connection.OCI8(check.defaultRole); oci8DSN != check.expected {
+			t.Fatalf("OCI8 for %q is %q not %q", check.connString, oci8DSN, check.expected)
+		}
+	}
+}
+
+func TestRMANAndString(t *testing.T) {
+	checks := map[string][2]string{
+		"/":                              {"/", "/"},
+		"/@ORCL_BACKUP":                  {"/@ORCL_BACKUP", "/@ORCL_BACKUP"},
+		"/@ORCL_BACKUP as sysbackup":     {"'/@ORCL_BACKUP as sysbackup'", "/@ORCL_BACKUP as sysbackup"},
+		"sys/secret@ORCL":                {"sys/secret@ORCL", "sys/*****@ORCL"},
+		"rman/\"p@ss\"@RCAT":             {"rman/\"p@ss\"@RCAT", "rman/*****@RCAT"},
+		"rman/\"p ss\"@RCAT":             {"rman/\"p ss\"@RCAT", "rman/*****@RCAT"},
+		"rman/pa;ss@RCAT":                {"rman/\"pa;ss\"@RCAT", "rman/*****@RCAT"},
+		"rman/pa'ss@RCAT":                {"rman/\"pa'ss\"@RCAT", "rman/*****@RCAT"},
+		"rman/Pa$s#_1@RCAT":              {"rman/Pa$s#_1@RCAT", "rman/*****@RCAT"},
+		"bkp/pa;ss@ORCL as sysbackup":    {"'bkp/\"pa;ss\"@ORCL as sysbackup'", "bkp/*****@ORCL as sysbackup"},
+		"bkp/\"p@ss\"@ORCL as SYSBACKUP": {"'bkp/\"p@ss\"@ORCL as sysbackup'", "bkp/*****@ORCL as sysbackup"},
+	}
+	for connString, expected := range checks {
+		connection, err := Parse(connString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rmanConnection := connection.RMAN(); rmanConnection != expected[0] {
+			t.Fatalf("RMAN for %q is %q not %q", connString, rmanConnection, expected[0])
+		}
+		if displayConnection := connection.String(); displayConnection != expected[1] {
+			t.Fatalf("String for %q is %q not %q", connString, displayConnection, expected[1])
+		}
+	}
+	// A double quote cannot be passed to RMAN inside a quoted password and a single quote
+	// cannot be inside the quoted role form so neither is parsed
+	for _, connString := range []string{"sys/pa\"ss@ORCL", "'sys/pa\"ss@ORCL as sysdba'", "sys/pa'ss@ORCL as sysdba", "sys/\"pa'ss\"@ORCL as sysdba"} {
+		if connection, err := Parse(connString); err == nil {
+			t.Fatalf("Parse %q accepted giving RMAN %q", connString, connection.RMAN())
+		}
+	}
+}
@@ -9,25 +9,43 @@ import "strings"
 
 import "github.com/daviesluke/logger"
 import "github.com/daviesluke/setup"
-import "github.com/daviesluke/utils"
 import "github.com/daviesluke/run_rman/config"
+import "github.com/daviesluke/run_rman/oracle/dsn"
 import _ "github.com/daviesluke/mattn/go-oci8"
 
 // local variables
 
+type JobDetails struct {
+	Status           string
+	Jobs             int
+	InputBytes       int64
+	OutputBytes      int64
+	CompressionRatio float64
+	ElapsedSeconds   float64
+}
+
+// Worst status wins when more than one RMAN session ran in the window
+
+var statusRank = map[string]int{
+	"COMPLETED":               1,
+	"COMPLETED WITH WARNINGS": 2,
+	"COMPLETED WITH ERRORS":   3,
+	"FAILED":                  4,
+}
+
 // local functions
 
-func checkConnection (connString string) {
+func checkConnection ( connection dsn.Connection, defaultRole string ) {
 	logger.Debug("Checking connection ...")
 
-	logger.Debugf("Connection string -> %s", connString)
+	logger.Debugf("Connection -> %s", connection)
 
-	if db, err := sql.Open("oci8", connString); err == nil {
+	if db, err := sql.Open("oci8", connection.OCI8(defaultRole)); err == nil {
 
 		if err = db.Ping(); err != nil {
-			logger.Errorf("Unable to connect to database %s using %s", setup.Database, utils.RemovePassword(connString,false))
+			logger.Errorf("Unable to connect to database %s using %s - %s", setup.Database, connection, err)
 		} else {
-			logger.Info("Successfully connected to the target database")
+			logger.Infof("Successfully connected using %s", connection)
 		}
 		
 		db.Close()
@@ -35,32 +53,50 @@ func checkConnection (connString string) {
 	
 	logger.Debug("Process complete")
 }
-	
 
-func checkTargetConnection () {
-	logger.Info("Checking target connection ...")
+func parseConnection ( configName string ) dsn.Connection {
+	logger.Debugf("Parsing connection %s ...", configName)
 
-	targetConnection := config.ConfigValues["TargetConnection"]
+	connection, err := dsn.Parse(config.ConfigValues[configName])
+	if err != nil {
+		logger.Errorf("Invalid %s - %s", configName, err)
+	}
 
-	if targetConnection == "/" {
-		targetConnection = "/@?as=sysdba" // sys/.@?as=sysdba
-	} else {
-		// If starts with SYS then add as=sysdba
-		regEx := "^[Ss][Yy][Ss][@/].+$"
-
-		if utils.CheckRegEx(targetConnection,regEx) {
-			// Check if it has a connection part 
-			regEx = ".+@.+"
-
-			if utils.CheckRegEx(targetConnection,regEx) {
-				targetConnection = strings.Join( []string{ targetConnection , "as=sysdba"} , "?")
-			} else {
-				targetConnection = strings.Join( []string{ targetConnection , "as=sysdba"} , "@?")
-			}
-		}
+	logger.Debug("Process complete")
+
+	return connection
+}
+
+func targetRole ( connection dsn.Connection ) string {
+	// Operating system, wallet and SYS connections are as SYSDBA unless a role is given, as RMAN does
+
+	if connection.External() || strings.EqualFold(connection.User, "sys") {
+		return "SYSDBA"
 	}
 
-	checkConnection(targetConnection)
+	return ""
+}
+
+func targetDSN () string {
+	logger.Debug("Setting target connection string ...")
+
+	connection := parseConnection("TargetConnection")
+
+	logger.Debug("Process complete")
+
+	return connection.OCI8(targetRole(connection))
+}
+
+func catalogDSN () string {
+	return parseConnection("CatalogConnection").OCI8("")
+}
+
+func checkTargetConnection () {
+	logger.Info("Checking target connection ...")
+
+	connection := parseConnection("TargetConnection")
+
+	checkConnection(connection, targetRole(connection))
 
 	logger.Debug("Process complete")
 }
@@ -68,12 +104,10 @@ func checkTargetConnection () {
 func checkCatalogConnection () {
 	logger.Info("Checking catalog connection ...")
 
-	catalogConnection := config.ConfigValues["CatalogConnection"]
-
-	if catalogConnection == "" { 
+	if config.ConfigValues["CatalogConnection"] == "" { 
 		logger.Infof("No RMAN catalog has been configured - running with control file only")
 	} else {
-		checkConnection(catalogConnection)
+		checkConnection(parseConnection("CatalogConnection"), "")
 	}
 
 	logger.Debug("Process complete")
@@ -82,6 +116,75 @@ func checkCatalogConnection () {
 
 // Global functions
 
+func VerifyBackup ( commandID string ) JobDetails {
+	logger.Infof("Verifying backup job %s ...", commandID)
+
+	// RMAN runs in its own session so the run is found by the command id it was given
+
+	var jobDetails JobDetails
+
+	db, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Warnf("Unable to connect to database %s to verify the backup job", setup.Database)
+		return jobDetails
+	}
+
+	defer db.Close()
+
+	// Every command run, not only backups, has a status row
+
+	statusQuery := "select status from v$rman_status where command_id = :1"
+
+	statusRows, err := db.Query(statusQuery, commandID)
+	if err != nil {
+		logger.Warnf("Unable to get the RMAN command status - %s", err)
+		return jobDetails
+	}
+
+	for statusRows.Next() {
+		var jobStatus string
+
+		if err := statusRows.Scan(&jobStatus); err != nil {
+			logger.Warnf("Unable to read the RMAN command status - %s", err)
+			break
+		}
+
+		logger.Debugf("RMAN command status %s", jobStatus)
+
+		if statusRank[jobStatus] >= statusRank[jobDetails.Status] {
+			jobDetails.Status = jobStatus
+		}
+	}
+
+	statusRows.Close()
+
+	detailsQuery := "select count(*), nvl(sum(input_bytes),0), nvl(sum(output_bytes),0), nvl(sum(elapsed_seconds),0) from v$rman_backup_job_details where command_id = :1"
+
+	if err := db.QueryRow(detailsQuery, commandID).Scan(&jobDetails.Jobs, &jobDetails.InputBytes, &jobDetails.OutputBytes, &jobDetails.ElapsedSeconds); err != nil {
+		logger.Warnf("Unable to get the backup job details - %s", err)
+		return jobDetails
+	}
+
+	if jobDetails.Status == "" {
+		logger.Warnf("No RMAN status found for command id %s", commandID)
+	}
+
+	if jobDetails.OutputBytes > 0 {
+		jobDetails.CompressionRatio = float64(jobDetails.InputBytes) / float64(jobDetails.OutputBytes)
+	}
+
+	logger.Infof("RMAN status %s, %d backup jobs, %d bytes read, %d bytes written, compression ratio %.2f, %.0f seconds", 
+		jobDetails.Status, jobDetails.Jobs, jobDetails.InputBytes, jobDetails.OutputBytes, jobDetails.CompressionRatio, jobDetails.ElapsedSeconds)
+
+	logger.Debug("Process complete")
+
+	return jobDetails
+}
+
+func (jobDetails JobDetails) Failed () bool {
+	return jobDetails.Status == "FAILED" || jobDetails.Status == "COMPLETED WITH ERRORS"
+}
+
 func CheckConnections () {
 	checkTargetConnection()
 
@@ -0,0 +1,293 @@
+package oracle
+
+// Standard imports
+
+import "database/sql"
+import "strconv"
+import "strings"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/utils"
+import "github.com/daviesluke/run_rman/config"
+
+// local variables
+
+//
+// Checks are listed in PreflightChecks (or SID_PreflightChecks) separated by ;
+// Each returns PASS, FAIL or SKIP with a detail for the log
+//
+
+type preflightCheck func ( db *sql.DB ) ( string, string )
+
+var preflightChecks = map[string]preflightCheck {
+	"OPENMODE"   : checkOpenMode,
+	"ARCHIVELOG" : checkArchiveLog,
+	"BCT"        : checkChangeTracking,
+	"FRA"        : checkRecoveryArea,
+	"RUNNING"    : checkRunningJobs,
+}
+
+var openMode     string
+var databaseRole string
+
+// local functions
+
+func getDatabaseMode ( db *sql.DB ) error {
+	logger.Debug("Getting database open mode and role ...")
+
+	if openMode != "" {
+		return nil
+	}
+
+	err := db.QueryRow("select open_mode, database_role from v$database").Scan(&openMode, &databaseRole)
+
+	logger.Debugf("Open mode %s, role %s", openMode, databaseRole)
+
+	logger.Debug("Process complete")
+
+	return err
+}
+
+func checkOpenMode ( db *sql.DB ) ( string, string ) {
+	logger.Debug("Checking open mode ...")
+
+	// Fails if the database is only started as v$database is not available until mounted
+
+	if err := getDatabaseMode(db); err != nil {
+		return "FAIL", "unable to get open mode - " + err.Error()
+	}
+
+	// Primary and standby databases are expected in different modes
+
+	var configName string
+
+	switch {
+	case databaseRole == "PRIMARY":
+		configName = "OpenModes"
+	case strings.HasSuffix(databaseRole, "STANDBY"):
+		configName = "StandbyOpenModes"
+	default:
+		return "FAIL", "unexpected database role " + databaseRole
+	}
+
+	for _, allowedMode := range strings.Split(config.ConfigValues[configName], ";") {
+		if strings.EqualFold(strings.TrimSpace(allowedMode), openMode) {
+			logger.Debug("Process complete")
+
+			return "PASS", openMode + " " + databaseRole
+		}
+	}
+
+	return "FAIL", openMode + " " + databaseRole + " is not in " + configName + " " + config.ConfigValues[configName]
+}
+
+func checkArchiveLog ( db *sql.DB ) ( string, string ) {
+	logger.Debug("Checking archive log mode ...")
+
+	if err := getDatabaseMode(db); err != nil {
+		return "FAIL", "unable to get open mode - " + err.Error()
+	}
+
+	if databaseRole == "PHYSICAL STANDBY" {
+		return "SKIP", "not needed on a physical standby"
+	}
+
+	var logMode string
+
+	if err := db.QueryRow("select log_mode from v$database").Scan(&logMode); err != nil {
+		return "FAIL", "unable to get log mode - " + err.Error()
+	}
+
+	// Without archive logs only a mounted database can be backed up
+
+	if logMode != "ARCHIVELOG" && openMode != "MOUNTED" {
+		return "FAIL", logMode + " and " + openMode + " so an online backup is not possible"
+	}
+
+	logger.Debug("Process complete")
+
+	return "PASS", logMode
+}
+
+func checkChangeTracking ( db *sql.DB ) ( string, string ) {
+	logger.Debug("Checking block change tracking ...")
+
+	if ! utils.FindInFile(config.RMANScript, "(?i)incremental", "", 0) {
+		return "SKIP", "not an incremental backup"
+	}
+
+	var trackingStatus string
+
+	if err := db.QueryRow("select status from v$block_change_tracking").Scan(&trackingStatus); err != nil {
+		return "FAIL", "unable to get block change tracking status - " + err.Error()
+	}
+
+	if trackingStatus != "ENABLED" {
+		return "FAIL", "block change tracking is " + trackingStatus
+	}
+
+	logger.Debug("Process complete")
+
+	return "PASS", "block change tracking is " + trackingStatus
+}
+
+func checkRecoveryArea ( db *sql.DB ) ( string, string ) {
+	logger.Debug("Checking recovery area usage ...")
+
+	maxPercent, err := strconv.ParseFloat(config.ConfigValues["FRAMaxPercent"], 64)
+	if err != nil {
+		logger.Errorf("Invalid FRAMaxPercent %s - must be a number", config.ConfigValues["FRAMaxPercent"])
+	}
+
+	var fraName     string
+	var usedPercent float64
+
+	fraQuery := "select name, round((space_used - space_reclaimable) * 100 / space_limit, 2) from v$recovery_file_dest where space_limit > 0"
+
+	if err := db.QueryRow(fraQuery).Scan(&fraName, &usedPercent); err != nil {
+		if err == sql.ErrNoRows {
+			return "SKIP", "no recovery area set"
+		}
+
+		return "FAIL", "unable to get recovery area usage - " + err.Error()
+	}
+
+	detail := fraName + " " + strconv.FormatFloat(usedPercent, 'f', 2, 64) + "% used, limit " + config.ConfigValues["FRAMaxPercent"] + "%"
+
+	if usedPercent > maxPercent {
+		return "FAIL", detail
+	}
+
+	logger.Debug("Process complete")
+
+	return "PASS", detail
+}
+
+func checkRunningJobs ( db *sql.DB ) ( string, string ) {
+	logger.Debug("Checking for running RMAN jobs ...")
+
+	// Live sessions rather than v$rman_status which can show RUNNING for sessions that died.
+	// Our own session shows as run_rman so does not match
+
+	var rmanSessions int
+
+	if err := db.QueryRow("select count(*) from v$session where lower(program) like 'rman%'").Scan(&rmanSessions); err != nil {
+		return "FAIL", "unable to get RMAN sessions - " + err.Error()
+	}
+
+	if rmanSessions > 0 {
+		return "FAIL", strconv.Itoa(rmanSessions) + " RMAN sessions already connected"
+	}
+
+	logger.Debug("Process complete")
+
+	return "PASS", "no RMAN sessions connected"
+}
+
+func standbyRole ( role string ) bool {
+	// A snapshot standby is open read write and diverging from the primary so not a backup source
+
+	return role == "PHYSICAL STANDBY" || role == "LOGICAL STANDBY"
+}
+
+// Global functions
+
+func CheckPlacement () {
+	logger.Info("Checking the database role against BackupOn ...")
+
+	backupOn := strings.ToUpper(strings.TrimSpace(config.ConfigValues["BackupOn"]))
+
+	if backupOn != "PRIMARY" && backupOn != "STANDBY" && backupOn != "ANY" {
+		logger.Errorf("Invalid BackupOn %s - must be PRIMARY, STANDBY or ANY", config.ConfigValues["BackupOn"])
+	}
+
+	if backupOn == "ANY" {
+		logger.Info("Backup runs in any database role")
+		return
+	}
+
+	db, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to database %s to check the database role", setup.Database)
+	}
+
+	defer db.Close()
+
+	if err := getDatabaseMode(db); err != nil {
+		logger.Errorf("Unable to get the role of database %s - %s", setup.Database, err)
+	}
+
+	if ( backupOn == "PRIMARY" && databaseRole != "PRIMARY" ) || ( backupOn == "STANDBY" && ! standbyRole(databaseRole) ) {
+		db.Close()
+		logger.Skipf("Database %s is %s and BackupOn is %s - skipping run", setup.Database, databaseRole, backupOn)
+	}
+
+	logger.Infof("Database %s is %s matching BackupOn %s", setup.Database, databaseRole, backupOn)
+
+	// Archive logs deleted on one side may still be needed by the other without a deletion policy
+
+	if utils.FindInFile(config.RMANScript, "(?i)delete.*archivelog", "", 0) {
+		var deletionPolicy int
+
+		policyQuery := "select count(*) from v$rman_configuration where name = 'ARCHIVELOG DELETION POLICY'"
+
+		if err := db.QueryRow(policyQuery).Scan(&deletionPolicy); err != nil {
+			logger.Warnf("Unable to check the archive log deletion policy - %s", err)
+		} else if deletionPolicy == 0 {
+			logger.Warn("Script deletes archive logs but no ARCHIVELOG DELETION POLICY is configured. Consider APPLIED ON ALL STANDBY or SHIPPED TO ALL STANDBY")
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+
+func PreflightChecks () {
+	logger.Info("Running pre-flight checks ...")
+
+	if strings.TrimSpace(config.ConfigValues["PreflightChecks"]) == "" {
+		logger.Info("No pre-flight checks configured")
+		return
+	}
+
+	db, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to database %s for pre-flight checks", setup.Database)
+	}
+
+	defer db.Close()
+
+	var failedChecks []string
+
+	for _, checkName := range strings.Split(config.ConfigValues["PreflightChecks"], ";") {
+		checkName = strings.ToUpper(strings.TrimSpace(checkName))
+
+		if checkName == "" {
+			continue
+		}
+
+		check, checkExists := preflightChecks[checkName]
+		if ! checkExists {
+			logger.Warnf("Unknown pre-flight check %s - must be one of OPENMODE, ARCHIVELOG, BCT, FRA or RUNNING", checkName)
+			continue
+		}
+
+		checkResult, checkDetail := check(db)
+
+		if checkResult == "FAIL" {
+			logger.Warnf("Pre-flight check %-10s - %s - %s", checkName, checkResult, checkDetail)
+			failedChecks = append(failedChecks, checkName)
+		} else {
+			logger.Infof("Pre-flight check %-10s - %s - %s", checkName, checkResult, checkDetail)
+		}
+	}
+
+	if len(failedChecks) > 0 {
+		logger.Errorf("Pre-flight checks failed - %s", strings.Join(failedChecks, ", "))
+	}
+
+	logger.Debug("Process complete")
+}
@@ -0,0 +1,456 @@
+package oracle
+
+// Standard imports
+
+import "database/sql"
+import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+import "github.com/daviesluke/run_rman/config"
+
+// local variables
+
+//
+// Backup times come from the catalog if one is set as it keeps more history than the
+// control file.  Datafiles, archive logs and gaps come from the target control file
+//
+
+var reportTimeFormat = "2006/01/02 15:04:05"
+
+var backupSetQueries = map[string]string {
+	"LEVEL0"     : "backup_type in ('D','I') and nvl(incremental_level,0) = 0",
+	"LEVEL1"     : "backup_type = 'I' and incremental_level > 0",
+	"ARCHIVELOG" : "backup_type = 'L'",
+}
+
+type reportLine struct {
+	Check  string
+	Value  string
+	Limit  string
+	Result string
+}
+
+type logGap struct {
+	Thread    int
+	FirstSeq  int
+	LastSeq   int
+	Resumed   time.Time
+}
+
+// local functions
+
+func backupSetFilter ( backupType string, fromCatalog bool ) string {
+	backupFilter := backupSetQueries[backupType]
+
+	if backupType == "ARCHIVELOG" {
+		return backupFilter
+	}
+
+	// Control file autobackups are also datafile sets so make sure a datafile is in the set
+
+	if fromCatalog {
+		return backupFilter + " and exists (select 1 from rc_backup_datafile f where f.bs_key = s.bs_key)"
+	}
+
+	return backupFilter + " and exists (select 1 from v$backup_datafile f where f.set_stamp = s.set_stamp and f.set_count = s.set_count and f.file# > 0)"
+}
+
+func reportTime ( timeString sql.NullString ) ( time.Time, bool ) {
+	if ! timeString.Valid {
+		return time.Time{}, false
+	}
+
+	reportedTime, err := time.ParseInLocation(reportTimeFormat, timeString.String, time.Local)
+	if err != nil {
+		logger.Warnf("Invalid time %s returned - %s", timeString.String, err)
+		return time.Time{}, false
+	}
+
+	return reportedTime, true
+}
+
+func reportLimit ( configName string ) ( time.Duration, string ) {
+	// An empty limit is not checked
+
+	if strings.TrimSpace(config.ConfigValues[configName]) == "" {
+		return 0, "-"
+	}
+
+	reportDuration := config.GetDuration(configName, 24 * time.Hour)
+
+	return reportDuration, config.ConfigValues[configName]
+}
+
+func lastBackup ( db *sql.DB, fromCatalog bool, dbid int64, backupType string ) sql.NullString {
+	logger.Debugf("Getting last %s backup ...", backupType)
+
+	var lastTime sql.NullString
+
+	backupQuery := "select to_char(max(s.completion_time),'YYYY/MM/DD HH24:MI:SS') from v$backup_set s where " + backupSetFilter(backupType, fromCatalog)
+
+	var err error
+
+	if fromCatalog {
+		backupQuery = "select to_char(max(s.completion_time),'YYYY/MM/DD HH24:MI:SS') from rc_backup_set s, rc_database d where s.db_key = d.db_key and d.dbid = :1 and " + backupSetFilter(backupType, fromCatalog)
+
+		err = db.QueryRow(backupQuery, dbid).Scan(&lastTime)
+	} else {
+		err = db.QueryRow(backupQuery).Scan(&lastTime)
+	}
+
+	if err != nil {
+		logger.Errorf("Unable to get last %s backup - %s", backupType, err)
+	}
+
+	logger.Debug("Process complete")
+
+	return lastTime
+}
+
+func staleDatafiles ( db *sql.DB, fromCatalog bool, dbid int64, maxAge time.Duration ) []string {
+	logger.Debug("Getting datafiles not backed up ...")
+
+	var datafiles []string
+
+	datafileQuery := `select d.file# || ' ' || d.name || ' last ' || nvl(to_char(max(b.completion_time),'YYYY/MM/DD HH24:MI:SS'),'never')
+	                  from v$datafile d left join v$backup_datafile b on b.file# = d.file#
+	                  group by d.file#, d.name
+	                  having max(b.completion_time) is null or max(b.completion_time) < sysdate - :1
+	                  order by d.file#`
+
+	if fromCatalog {
+		datafileQuery = `select d.file# || ' ' || d.name || ' last ' || nvl(to_char(max(b.completion_time),'YYYY/MM/DD HH24:MI:SS'),'never')
+		                 from rc_database r join rc_datafile d on d.db_key = r.db_key and d.drop_time is null
+		                 left join rc_backup_datafile b on b.db_key = d.db_key and b.file# = d.file#
+		                 where r.dbid = :1
+		                 group by d.file#, d.name
+		                 having max(b.completion_time) is null or max(b.completion_time) < sysdate - :2
+		                 order by d.file#`
+	}
+
+	// Binds are by position so in the order they appear
+
+	queryArgs := []interface{}{ maxAge.Hours() / 24 }
+
+	if fromCatalog {
+		queryArgs = []interface{}{ dbid, maxAge.Hours() / 24 }
+	}
+
+	datafileRows, err := db.Query(datafileQuery, queryArgs...)
+	if err != nil {
+		logger.Errorf("Unable to get datafile backups - %s", err)
+	}
+
+	defer datafileRows.Close()
+
+	for datafileRows.Next() {
+		var datafile string
+
+		if err := datafileRows.Scan(&datafile); err != nil {
+			logger.Errorf("Unable to read datafile backups - %s", err)
+		}
+
+		datafiles = append(datafiles, datafile)
+	}
+
+	logger.Debugf("%d datafiles not backed up", len(datafiles))
+
+	logger.Debug("Process complete")
+
+	return datafiles
+}
+
+func archiveLogGaps ( db *sql.DB, sinceTime time.Time ) []logGap {
+	logger.Debug("Finding archive log gaps ...")
+
+	// A log is available if still on disk or in a backup.  Only the current incarnation counts
+
+	logQuery := `select thread#, sequence#, to_char(first_time,'YYYY/MM/DD HH24:MI:SS') from v$archived_log
+	             where status = 'A' and next_time > to_date(:1,'YYYY/MM/DD HH24:MI:SS')
+	             and resetlogs_change# = (select resetlogs_change# from v$database)
+	             union
+	             select thread#, sequence#, to_char(first_time,'YYYY/MM/DD HH24:MI:SS') from v$backup_redolog
+	             where next_time > to_date(:2,'YYYY/MM/DD HH24:MI:SS')
+	             and resetlogs_change# = (select resetlogs_change# from v$database)
+	             union
+	             select thread#, sequence#, to_char(first_time,'YYYY/MM/DD HH24:MI:SS') from v$log
+	             where status = 'CURRENT'
+	             order by 1, 2`
+
+	logRows, err := db.Query(logQuery, sinceTime.Format(reportTimeFormat), sinceTime.Format(reportTimeFormat))
+	if err != nil {
+		logger.Errorf("Unable to get archive logs - %s", err)
+	}
+
+	defer logRows.Close()
+
+	var gaps []logGap
+
+	lastThread   := -1
+	lastSequence := 0
+
+	for logRows.Next() {
+		var thread     int
+		var sequence   int
+		var firstTime  sql.NullString
+
+		if err := logRows.Scan(&thread, &sequence, &firstTime); err != nil {
+			logger.Errorf("Unable to read archive logs - %s", err)
+		}
+
+		if thread == lastThread && sequence > lastSequence + 1 {
+			resumedTime, _ := reportTime(firstTime)
+
+			gaps = append(gaps, logGap{ Thread: thread, FirstSeq: lastSequence + 1, LastSeq: sequence - 1, Resumed: resumedTime })
+		}
+
+		lastThread   = thread
+		lastSequence = sequence
+	}
+
+	logger.Debugf("%d archive log gaps found", len(gaps))
+
+	logger.Debug("Process complete")
+
+	return gaps
+}
+
+func level0Backups ( db *sql.DB ) []time.Time {
+	logger.Debug("Getting available level 0 backups ...")
+
+	// Only sets which still have every piece available
+
+	level0Query := `select to_char(s.start_time,'YYYY/MM/DD HH24:MI:SS'), to_char(s.completion_time,'YYYY/MM/DD HH24:MI:SS') from v$backup_set s
+	                where ` + backupSetFilter("LEVEL0", false) + `
+	                and not exists (select 1 from v$backup_piece p where p.set_stamp = s.set_stamp and p.set_count = s.set_count and p.status != 'A')
+	                order by s.completion_time`
+
+	level0Rows, err := db.Query(level0Query)
+	if err != nil {
+		logger.Errorf("Unable to get level 0 backups - %s", err)
+	}
+
+	defer level0Rows.Close()
+
+	var level0Times []time.Time
+
+	for level0Rows.Next() {
+		var startTime      sql.NullString
+		var completionTime sql.NullString
+
+		if err := level0Rows.Scan(&startTime, &completionTime); err != nil {
+			logger.Errorf("Unable to read level 0 backups - %s", err)
+		}
+
+		// Start and completion pairs
+
+		startedAt, _   := reportTime(startTime)
+		completedAt, _ := reportTime(completionTime)
+
+		level0Times = append(level0Times, startedAt, completedAt)
+	}
+
+	logger.Debugf("%d level 0 backup sets available", len(level0Times) / 2)
+
+	logger.Debug("Process complete")
+
+	return level0Times
+}
+
+func ageResult ( lastTime sql.NullString, maxAge time.Duration ) ( string, string ) {
+	backupTime, ok := reportTime(lastTime)
+	if ! ok {
+		return "never", "FAIL"
+	}
+
+	if maxAge > 0 && time.Since(backupTime) > maxAge {
+		return lastTime.String, "FAIL"
+	}
+
+	return lastTime.String, "OK"
+}
+
+// Global functions
+
+func Report () bool {
+	logger.Info("Reporting backup coverage ...")
+
+	db, err := sql.Open("oci8", targetDSN())
+	if err != nil {
+		logger.Errorf("Unable to connect to database %s", setup.Database)
+	}
+
+	defer db.Close()
+
+	backupDB     := db
+	fromCatalog  := false
+	backupSource := "control file"
+
+	if config.ConfigValues["CatalogConnection"] != "" {
+		catalogDB, err := sql.Open("oci8", catalogDSN())
+		if err == nil {
+			err = catalogDB.Ping()
+		}
+
+		if err != nil {
+			logger.Warnf("Unable to connect to the catalog - using the control file - %s", err)
+		} else {
+			defer catalogDB.Close()
+
+			backupDB     = catalogDB
+			fromCatalog  = true
+			backupSource = "catalog"
+		}
+	}
+
+	// The catalog is searched by DBID as the SID may not be the database name e.g. RAC instances
+
+	var dbid int64
+
+	if fromCatalog {
+		dbid = targetDBID(db)
+	}
+
+	var reportLines []reportLine
+
+	// Last backup of each type against its age limit
+
+	for _, backupCheck := range []struct {
+		Type   string
+		Check  string
+		Config string
+	}{
+		{ "LEVEL0",     "Last level 0 backup",    "ReportLevel0Age" },
+		{ "LEVEL1",     "Last level 1 backup",    "ReportLevel1Age" },
+		{ "ARCHIVELOG", "Last archivelog backup", "ReportArchivelogAge" },
+	} {
+		maxAge, limitText := reportLimit(backupCheck.Config)
+
+		backupValue, backupResult := ageResult(lastBackup(backupDB, fromCatalog, dbid, backupCheck.Type), maxAge)
+
+		// No age limit means the backup type is not expected
+
+		if maxAge == 0 && backupValue == "never" {
+			backupResult = "OK"
+		}
+
+		reportLines = append(reportLines, reportLine{ backupCheck.Check, backupValue, limitText, backupResult })
+	}
+
+	// Datafiles
+
+	var datafiles []string
+
+	if datafileAge, limitText := reportLimit("ReportDatafileAge"); datafileAge > 0 {
+		datafiles = staleDatafiles(backupDB, fromCatalog, dbid, datafileAge)
+
+		datafileResult := "OK"
+
+		if len(datafiles) > 0 {
+			datafileResult = "FAIL"
+		}
+
+		reportLines = append(reportLines, reportLine{ "Datafiles not backed up", strconv.Itoa(len(datafiles)), limitText, datafileResult })
+	}
+
+	// Archive log gaps since the oldest level 0 as they limit how far back recovery can go.
+	// Gaps since the latest level 0 mean even the latest backup cannot be rolled forward
+
+	level0Times := level0Backups(db)
+
+	var gaps []logGap
+
+	earliestValue  := "none"
+	earliestResult := "FAIL"
+	gapResult      := "OK"
+	gapCount       := 0
+
+	if len(level0Times) > 0 {
+		gaps = archiveLogGaps(db, level0Times[0])
+
+		lastLevel0Start := level0Times[len(level0Times) - 2]
+
+		var latestGap time.Time
+
+		for _, gap := range gaps {
+			if gap.Resumed.After(latestGap) {
+				latestGap = gap.Resumed
+			}
+
+			if gap.Resumed.After(lastLevel0Start) {
+				gapCount++
+			}
+		}
+
+		if gapCount > 0 {
+			gapResult = "FAIL"
+		}
+
+		// The oldest level 0 started after the last gap is the earliest point recovery can reach
+
+		for timeIndex := 0; timeIndex < len(level0Times); timeIndex += 2 {
+			if level0Times[timeIndex].After(latestGap) {
+				earliestValue  = level0Times[timeIndex + 1].Format(reportTimeFormat)
+				earliestResult = "OK"
+
+				if recoveryWindow, _ := reportLimit("ReportRecoveryWindow"); recoveryWindow > 0 && time.Since(level0Times[timeIndex + 1]) < recoveryWindow {
+					earliestResult = "FAIL"
+				}
+
+				break
+			}
+		}
+	}
+
+	_, windowText := reportLimit("ReportRecoveryWindow")
+
+	reportLines = append(reportLines, reportLine{ "Archive log gaps", strconv.Itoa(gapCount), "0", gapResult })
+	reportLines = append(reportLines, reportLine{ "Earliest recoverable point", earliestValue, windowText, earliestResult })
+
+	// Print the report
+
+	breached := false
+
+	fmt.Printf("Backup report for %s (backups from %s)\n\n", setup.Database, backupSource)
+
+	fmt.Printf("%-28s  %-19s  %8s  %s\n", "CHECK", "VALUE", "LIMIT", "RESULT")
+
+	for _, line := range reportLines {
+		fmt.Printf("%-28s  %-19s  %8s  %s\n", line.Check, line.Value, line.Limit, line.Result)
+
+		if line.Result == "FAIL" {
+			breached = true
+		}
+	}
+
+	if len(datafiles) > 0 {
+		fmt.Println("\nDatafiles not backed up")
+
+		for _, datafile := range datafiles {
+			fmt.Printf("  %s\n", datafile)
+		}
+	}
+
+	if len(gaps) > 0 {
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i].Resumed.Before(gaps[j].Resumed) })
+
+		fmt.Println("\nArchive logs not on disk or in a backup")
+
+		for _, gap := range gaps {
+			fmt.Printf("  Thread %d sequence %d to %d\n", gap.Thread, gap.FirstSeq, gap.LastSeq)
+		}
+	}
+
+	logger.Infof("Backup report thresholds breached %t", breached)
+
+	logger.Info("Process complete")
+
+	return breached
+}
@@ -4,11 +4,14 @@ package rman
 
 import "bufio"
 import "fmt"
+import "io/ioutil"
 import "os"
 import "os/exec"
 import "path/filepath"
+import "regexp"
 import "strconv"
 import "strings"
+import "time"
 
 // Local imports
 
@@ -19,12 +22,18 @@ import "github.com/daviesluke/utils"
 import "github.com/daviesluke/run_rman/config"
 import "github.com/daviesluke/run_rman/general"
 import "github.com/daviesluke/run_rman/locker"
+import "github.com/daviesluke/run_rman/oracle"
+import "github.com/daviesluke/run_rman/oracle/dsn"
 
 // local variables
 
 var ResetConfigFileName     string
 var ResetConfigLockFileName string
 
+// Set once RMAN has been seen to connect so later runs do not check again
+
+var connectionsChecked bool
+
 // local functions
 
 func checkDir(dirName string) {
@@ -76,56 +85,38 @@ func getConfig(outputFile string) {
 	logger.Debug("Process complete")
 }
 
-func addConnections ( cmdFileName string, targetConn string, catalogConn string ) {
-	logger.Infof("Adding connections to file %s ...", cmdFileName)
-
-	newCmdFileName := strings.Join( []string{ cmdFileName , "tmp" }, "." )
-	logger.Debugf("New command file %s", newCmdFileName)
+func connectCommands ( targetConn string, catalogConn string ) string {
+	logger.Info("Setting connection commands ...")
 
-	if newCmdFile, err :=  os.OpenFile(newCmdFileName, os.O_CREATE | os.O_WRONLY | os.O_TRUNC, 0600 ); err == nil {
-		// Write the connection strings
+	// Connections are only ever sent down the pipe to RMAN so no credentials are written to disk
 
-		connString := strings.Join( []string{ "connect", "target", targetConn }, " ")
-
-		if _, err := newCmdFile.WriteString(connString + setup.NewLine); err != nil {
-			logger.Errorf("Unable to write target connection to file %s", newCmdFileName)
-		}
+	targetConnection, err := dsn.Parse(targetConn)
+	if err != nil {
+		logger.Errorf("Invalid TargetConnection - %s", err)
+	}
 
-		logger.Debug("Target connection written")
+	connCommands := strings.Join( []string{ "connect", "target", targetConnection.RMAN() }, " ") + ";\n"
 
-		if catalogConn != "" {
-			connString = strings.Join( []string{ "connect", "catalog", catalogConn }, " ")
+	logger.Debugf("Target connection set to %s", targetConnection)
 
-			if _, err := newCmdFile.WriteString(connString + "\n"); err != nil {
-				logger.Errorf("Unable to write catalog connection to file %s", newCmdFileName)
-			}
-			
-			logger.Debug("Catalog connection written")
+	if catalogConn != "" {
+		catalogConnection, err := dsn.Parse(catalogConn)
+		if err != nil {
+			logger.Errorf("Invalid CatalogConnection - %s", err)
 		}
 
-		newCmdFile.Close()
-
-		utils.CopyFileContents(cmdFileName, newCmdFileName, "")
+		connCommands += strings.Join( []string{ "connect", "catalog", catalogConnection.RMAN() }, " ") + ";\n"
 
-		if err := os.Rename(newCmdFileName, cmdFileName); err != nil {
-			logger.Errorf("Unable to rename file from %s to %s", newCmdFileName, cmdFileName)
-		}
-		logger.Debugf("Renamed file %s to %s", newCmdFileName, cmdFileName)
-	} else {
-		logger.Errorf("Unable to open file %s", newCmdFileName)
+		logger.Debug("Catalog connection set")
 	}
 
 	logger.Debug("Process complete")
-}
-
-func runRMAN(cmdFile string, outFile string) {
-	logger.Info("Running RMAN ...")
 
-	setup.CopyFileToLog("Command file contents", cmdFile)
-
-	addConnections(cmdFile, config.ConfigValues["TargetConnection"], config.ConfigValues["CatalogConnection"])
+	return connCommands
+}
 
-	cmdParams := []string{ "cmdfile", cmdFile}
+func execRMAN ( rmanInput string, outFile string ) error {
+	logger.Debugf("Running %s with output to %s ...", general.RMAN, outFile)
 
 	// Open the output file to capture the stdout and stderr
 
@@ -136,11 +127,11 @@ func runRMAN(cmdFile string, outFile string) {
 
 	// Set the command (does not run it yet)
 
-	cmd := exec.Command(general.RMAN , cmdParams ...)
-	logger.Debugf("Set command to run %s cmdfile %s", general.RMAN, cmdFile)
+	cmd := exec.Command(general.RMAN)
 	
-	// Setting the stdout and stderr 
+	// Setting the stdin, stdout and stderr 
 
+	cmd.Stdin  = strings.NewReader(rmanInput)
 	cmd.Stdout = out
 	cmd.Stderr = out 
 
@@ -151,6 +142,68 @@ func runRMAN(cmdFile string, outFile string) {
 	// Close output file
 	out.Close()
 
+	logger.Debug("Process complete")
+
+	return rmanErr
+}
+
+func checkConnections ( connCommands string ) {
+	if connectionsChecked {
+		return
+	}
+
+	logger.Info("Checking RMAN can connect ...")
+
+	// RMAN carries on reading stdin after a failed connect so the script would run against
+	// the wrong target or without the catalog.  Connect on its own first and stop on any error
+
+	outFile := strings.Join( []string{ setup.TmpFileName, "connect", "out" }, ".")
+
+	rmanErr := execRMAN(connCommands + "exit;\n", outFile)
+
+	setup.CopyFileToLog("RMAN connection output", outFile)
+
+	connectFailed := rmanErr != nil || utils.FindInFile(outFile, "(RMAN-[0-9]{5}|ORA-[0-9]{5})", "", 0)
+
+	if err := os.Remove(outFile); err != nil {
+		logger.Warnf("Unable to remove file %s", outFile)
+	}
+
+	if connectFailed {
+		logger.Errorf("RMAN was unable to connect. See log for details")
+	}
+
+	connectionsChecked = true
+
+	logger.Info("RMAN connections successful")
+}
+
+func runRMAN(cmdFile string, outFile string) string {
+	logger.Info("Running RMAN ...")
+
+	setup.CopyFileToLog("Command file contents", cmdFile)
+
+	// Each run is tagged so its jobs can be told apart from any other RMAN session on the database
+	// Command ids are limited to 33 characters
+
+	commandID := strings.Join( []string{ "run_rman", setup.CurrentPID, strconv.FormatInt(time.Now().UnixNano(), 36) }, "_")
+
+	logger.Debugf("Command id set to %s", commandID)
+
+	// RMAN reads the connections and then runs the command file from stdin
+
+	connCommands := connectCommands(config.ConfigValues["TargetConnection"], config.ConfigValues["CatalogConnection"])
+
+	checkConnections(connCommands)
+
+	rmanInput := connCommands + "set command id to '" + commandID + "';\n"
+
+	rmanInput += "@" + cmdFile + "\n" + "exit;\n"
+
+	logger.Debugf("Running %s with command file %s on stdin", general.RMAN, cmdFile)
+
+	rmanErr := execRMAN(rmanInput, outFile)
+
 	setup.CopyFileToLog("RMAN output", outFile)
 
 	if rmanErr != nil {
@@ -162,6 +215,31 @@ func runRMAN(cmdFile string, outFile string) {
 	} else {
 		logger.Info("RMAN run successful")
 	}
+
+	return commandID
+}
+
+func runCommands ( commandName string, rmanCommands ...string ) {
+	logger.Infof("Running RMAN %s ...", commandName)
+
+	// Command and output files alongside the temp file so they are tidied with it
+
+	cmdFile := strings.Join( []string{ setup.TmpFileName, commandName, "rcv" }, ".")
+	outFile := strings.Join( []string{ setup.TmpFileName, commandName, "out" }, ".")
+
+	if err := ioutil.WriteFile(cmdFile, []byte(strings.Join(rmanCommands, "\n") + "\n"), 0600); err != nil {
+		logger.Errorf("Unable to write command file %s - %s", cmdFile, err)
+	}
+
+	runRMAN(cmdFile, outFile)
+
+	for _, fileName := range []string{ cmdFile, outFile } {
+		if err := os.Remove(fileName); err != nil {
+			logger.Warnf("Unable to remove file %s", fileName)
+		}
+	}
+
+	logger.Debug("Process complete")
 }
 
 func checkRMAN(logFileName string) bool {
@@ -229,9 +307,57 @@ func checkRMAN(logFileName string) bool {
 
 	logger.Debugf("Regular expression set to %s, ignoring %s, ignore groups %d", regEx, ignoreRegEx, regGroup)
 
+	logger.AddHistoryErrors(findCodes(logFileName, regEx, ignoreRegEx))
+
 	return utils.FindInFile(logFileName,regEx,ignoreRegEx,regGroup) 
 }
 
+func findCodes ( fileName string, regEx string, ignoreRegEx string ) []string {
+	logger.Debug("Finding error codes for the history ...")
+
+	var errorCodes []string
+
+	codeRegEx := regexp.MustCompile(regEx)
+
+	// Ignore codes have been validated so always compile
+	// With only ORA codes ignored the expression starts with an empty alternative which would match everything
+
+	var ignoreCodeRegEx *regexp.Regexp
+
+	ignoreRegEx = strings.TrimPrefix(ignoreRegEx, "|")
+
+	if ignoreRegEx != "" {
+		ignoreCodeRegEx = regexp.MustCompile(ignoreRegEx)
+	}
+
+	codeFile, err := os.Open(fileName)
+	if err != nil {
+		logger.Warnf("Unable to open file %s to find error codes", fileName)
+		return errorCodes
+	}
+
+	defer codeFile.Close()
+
+	codesFound := make(map[string]bool)
+
+	codeScanner := bufio.NewScanner(codeFile)
+
+	for codeScanner.Scan() {
+		for _, errorCode := range codeRegEx.FindAllString(codeScanner.Text(), -1) {
+			if codesFound[errorCode] || (ignoreCodeRegEx != nil && ignoreCodeRegEx.MatchString(errorCode)) {
+				continue
+			}
+
+			codesFound[errorCode] = true
+			errorCodes = append(errorCodes, errorCode)
+		}
+	}
+
+	logger.Debugf("%d error codes found", len(errorCodes))
+
+	return errorCodes
+}
+
 func saveConfig (newConfigFileName string) {
 	logger.Info("Saving RMAN configuration ...")
 
@@ -396,7 +522,7 @@ func setConfig( oldConfig , newConfig string ) {
 func removeLockEntry(lockFile string, lockPID string, resetFile string) {
 	logger.Debug("Removing lock entry and associated file ...")
 
-	locker.RemoveLockEntry(lockFile, lockPID)
+	locker.RemoveLockEntry(lockFile, lockPID, setup.HostName)
 
 	// Remember to remove the associated file 
 
@@ -455,6 +581,82 @@ func CheckConfig () {
 	logger.Debug("Process complete")
 }
 
+func WriteValidateScript () {
+	logger.Info("Generating restore validation script ...")
+
+	validateDays, err := strconv.Atoi(config.ConfigValues["ValidateDays"])
+	if err != nil || validateDays < 0 {
+		logger.Errorf("ValidateDays %s must be a number of days", config.ConfigValues["ValidateDays"])
+	}
+
+	// Checks the backups for a restore now and back to the start of the window, and the archive logs between
+
+	validateLines := []string{ "run {", "<parallel>", "restore database validate;" }
+
+	if validateDays > 0 {
+		validateLines = append(validateLines,
+			fmt.Sprintf("restore database until time 'sysdate-%d' validate;", validateDays),
+			fmt.Sprintf("restore archivelog from time 'sysdate-%d' validate;", validateDays))
+	}
+
+	if utils.CheckRegEx(config.ConfigValues["ValidateControlfile"], "^[YyTt]") {
+		validateLines = append(validateLines, "restore controlfile validate;")
+	}
+
+	validateLines = append(validateLines, "}")
+
+	logger.Debugf("Validation script -> %s", strings.Join(validateLines, " "))
+
+	if err := ioutil.WriteFile(config.RMANScript, []byte(strings.Join(validateLines, "\n") + "\n"), 0600); err != nil {
+		logger.Errorf("Unable to write validation script %s - %s", config.RMANScript, err)
+	}
+
+	logger.Debug("Process complete")
+}
+
+func RegisterDatabase () {
+	logger.Info("Checking the database is registered in the catalog ...")
+
+	if config.ConfigValues["CatalogConnection"] == "" {
+		logger.Debug("No catalog configured")
+		return
+	}
+
+	if ! utils.CheckRegEx(config.ConfigValues["CatalogRegister"], "^[YyTt]") {
+		logger.Info("Registering in the catalog is not enabled")
+		return
+	}
+
+	if oracle.Registered() {
+		logger.Infof("Database %s is registered in the catalog", setup.Database)
+		return
+	}
+
+	logger.Infof("Database %s is not in the catalog - registering", setup.Database)
+
+	runCommands("register", "register database;")
+
+	logger.Debug("Process complete")
+}
+
+func ResyncCatalog () {
+	logger.Info("Resyncing the catalog ...")
+
+	if config.ConfigValues["CatalogConnection"] == "" {
+		logger.Debug("No catalog configured")
+		return
+	}
+
+	if ! utils.CheckRegEx(config.ConfigValues["CatalogResync"], "^[YyTt]") {
+		logger.Info("Resyncing the catalog is not enabled")
+		return
+	}
+
+	runCommands("resync", "resync catalog;")
+
+	logger.Debug("Process complete")
+}
+
 func RunScript () {
 	logger.Info("Running main RMAN script ...")
 
@@ -472,7 +674,17 @@ func RunScript () {
 
 	os.Setenv("NLS_DATE_FORMAT", config.ConfigValues["NLS_DATE_FORMAT"])
 
-	runRMAN(newCommandFile,setup.TmpFileName)
+	commandID := runRMAN(newCommandFile,setup.TmpFileName)
+
+	// Check what RMAN recorded for the job as not every failure leaves an error code in the log
+
+	jobDetails := oracle.VerifyBackup(commandID)
+
+	logger.SetHistoryJob(jobDetails.Status, jobDetails.InputBytes, jobDetails.OutputBytes, jobDetails.CompressionRatio, jobDetails.ElapsedSeconds)
+
+	if jobDetails.Failed() {
+		logger.Errorf("RMAN reported the job as %s. Check log for details", jobDetails.Status)
+	}
 
 	// Do not need the log or command file
 
@@ -0,0 +1,168 @@
+package oratab
+
+// Standard imports
+
+import "bufio"
+import "os"
+import "path/filepath"
+import "strings"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+import "github.com/daviesluke/setup"
+
+// local variables
+
+//
+// Lines are SID:ORACLE_HOME:FLAG # comment.  The home may contain a drive letter on Windows
+// so the SID is up to the first : and the flag is after the last.  Older Windows files
+// separated with ; are still read
+//
+
+type Entry struct {
+	SID       string
+	Home      string
+	Flag      string
+	AutoStart bool
+	Comment   string
+	FileName  string
+	LineNo    int
+}
+
+type Oratab struct {
+	Entries []Entry
+}
+
+// local functions
+
+func parseLine ( oratabLine string ) ( Entry, bool ) {
+	var oratabEntry Entry
+
+	if commentIndex := strings.Index(oratabLine, "#"); commentIndex >= 0 {
+		oratabEntry.Comment = strings.TrimSpace(oratabLine[commentIndex+1:])
+		oratabLine = oratabLine[:commentIndex]
+	}
+
+	oratabLine = strings.TrimSpace(oratabLine)
+
+	if oratabLine == "" {
+		return oratabEntry, false
+	}
+
+	delimiter := ":"
+
+	if ! strings.Contains(oratabLine, ":") || ( strings.Contains(oratabLine, ";") && setup.PathDelimiter == ";" ) {
+		delimiter = ";"
+	}
+
+	sidEnd := strings.Index(oratabLine, delimiter)
+	if sidEnd < 0 {
+		return oratabEntry, false
+	}
+
+	oratabEntry.SID  = strings.TrimSpace(oratabLine[:sidEnd])
+	oratabEntry.Home = oratabLine[sidEnd+1:]
+
+	if flagStart := strings.LastIndex(oratabEntry.Home, delimiter); flagStart >= 0 {
+		oratabFlag := strings.ToUpper(strings.TrimSpace(oratabEntry.Home[flagStart+1:]))
+
+		// Only a flag if it looks like one otherwise it is part of the home e.g. C:\
+
+		if oratabFlag == "" || oratabFlag == "Y" || oratabFlag == "N" || oratabFlag == "W" {
+			oratabEntry.Flag = oratabFlag
+			oratabEntry.Home = oratabEntry.Home[:flagStart]
+		}
+	}
+
+	oratabEntry.Home      = strings.TrimSpace(oratabEntry.Home)
+	oratabEntry.AutoStart = oratabEntry.Flag == "Y" || oratabEntry.Flag == "W"
+
+	return oratabEntry, oratabEntry.SID != ""
+}
+
+// Global functions
+
+func Read ( oratabPath string ) *Oratab {
+	logger.Debugf("Reading oratab files %s ...", oratabPath)
+
+	oratab := &Oratab{}
+
+	for _, oratabName := range strings.Split(oratabPath, setup.PathDelimiter) {
+		oratabFile, err := os.Open(oratabName)
+		if err != nil {
+			logger.Tracef("Oratab file %s not found. Ignoring ...", oratabName)
+			continue
+		}
+
+		oratabScanner := bufio.NewScanner(oratabFile)
+
+		lineNo := 0
+
+		for oratabScanner.Scan() {
+			lineNo++
+
+			if oratabEntry, ok := parseLine(oratabScanner.Text()); ok {
+				oratabEntry.FileName = oratabName
+				oratabEntry.LineNo   = lineNo
+
+				logger.Tracef("Oratab entry %s home %s flag %s from %s line %d", oratabEntry.SID, oratabEntry.Home, oratabEntry.Flag, oratabName, lineNo)
+
+				oratab.Entries = append(oratab.Entries, oratabEntry)
+			}
+		}
+
+		oratabFile.Close()
+	}
+
+	logger.Debugf("%d oratab entries read", len(oratab.Entries))
+
+	logger.Debug("Process complete")
+
+	return oratab
+}
+
+func (oratab *Oratab) Lookup ( sid string ) []Entry {
+	var oratabEntries []Entry
+
+	// Windows SIDs are not case sensitive
+
+	for _, oratabEntry := range oratab.Entries {
+		if oratabEntry.SID == sid || ( setup.PathDelimiter == ";" && strings.EqualFold(oratabEntry.SID, sid) ) {
+			oratabEntries = append(oratabEntries, oratabEntry)
+		}
+	}
+
+	return oratabEntries
+}
+
+func (oratab *Oratab) Databases () []Entry {
+	var oratabEntries []Entry
+
+	found := make(map[string]bool)
+
+	for _, oratabEntry := range oratab.Entries {
+		if oratabEntry.IsDatabase() && ! found[oratabEntry.SID] {
+			found[oratabEntry.SID] = true
+			oratabEntries = append(oratabEntries, oratabEntry)
+		}
+	}
+
+	return oratabEntries
+}
+
+func (oratabEntry Entry) IsDatabase () bool {
+	// ASM (+ASM), the management database (-MGMTDB) and the * home entry are not backed up
+
+	return oratabEntry.SID != "*" && oratabEntry.SID[0] != '+' && oratabEntry.SID[0] != '-'
+}
+
+func (oratabEntry Entry) RMAN () string {
+	return filepath.Join(oratabEntry.Home, "bin", "rman" + setup.ExecutableSuffix)
+}
+
+func (oratabEntry Entry) HasRMAN () bool {
+	rmanInfo, err := os.Stat(oratabEntry.RMAN())
+
+	return err == nil && ! rmanInfo.IsDir()
+}
@@ -0,0 +1,118 @@
+package oratab
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/daviesluke/setup"
+)
+
+func TestParseLine(t *testing.T) {
+	setup.PathDelimiter = ":"
+
+	checks := []struct {
+		line     string
+		expected Entry
+		ok       bool
+	}{
+		{"ORCL:/u01/app/oracle/product/19c:Y", Entry{SID: "ORCL", Home: "/u01/app/oracle/product/19c", Flag: "Y", AutoStart: true}, true},
+		{"ORCL:/u01/app/oracle/product/19c:N", Entry{SID: "ORCL", Home: "/u01/app/oracle/product/19c", Flag: "N"}, true},
+		{"ORCL:/u01/app/oracle/product/19c:w", Entry{SID: "ORCL", Home: "/u01/app/oracle/product/19c", Flag: "W", AutoStart: true}, true},
+		{"ORCL:/u01/app/oracle/product/19c:", Entry{SID: "ORCL", Home: "/u01/app/oracle/product/19c"}, true},
+		{"ORCL:/u01/app/oracle/product/19c", Entry{SID: "ORCL", Home: "/u01/app/oracle/product/19c"}, true},
+		{" ORCL : /u01/app/19c : Y # line added by Agent", Entry{SID: "ORCL", Home: "/u01/app/19c", Flag: "Y", AutoStart: true, Comment: "line added by Agent"}, true},
+		{`ORCL:C:\app\oracle\product\19c:N`, Entry{SID: "ORCL", Home: `C:\app\oracle\product\19c`, Flag: "N"}, true},
+		{`ORCL:C:\app\oracle\product\19c`, Entry{SID: "ORCL", Home: `C:\app\oracle\product\19c`}, true},
+		{"ORCL;/u01/app/19c;Y", Entry{SID: "ORCL", Home: "/u01/app/19c", Flag: "Y", AutoStart: true}, true},
+		{"# ORCL:/u01/app/19c:Y", Entry{Comment: "ORCL:/u01/app/19c:Y"}, false},
+		{"", Entry{}, false},
+		{"   ", Entry{}, false},
+		{"ORCL", Entry{}, false},
+		{":/u01/app/19c:Y", Entry{Home: "/u01/app/19c", Flag: "Y", AutoStart: true}, false},
+	}
+	for _, check := range checks {
+		entry, ok := parseLine(check.line)
+		if ok != check.ok {
+			t.Fatalf("Line %q gave ok %v not %v", check.line, ok, check.ok)
+		}
+		if entry != check.expected {
+			t.Fatalf("Line %q gave %+v not %+v", check.line, entry, check.expected)
+		}
+	}
+}
+
+func TestWindowsParseLine(t *testing.T) {
+	setup.PathDelimiter = ";"
+	defer func() { setup.PathDelimiter = ":" }()
+
+	expected := Entry{SID: "ORCL", Home: `C:\app\oracle\product\19c`, Flag: "Y", AutoStart: true}
+	if entry, ok := parseLine(`ORCL;C:\app\oracle\product\19c;Y`); !ok || entry != expected {
+		t.Fatalf("Windows line gave %+v not %+v", entry, expected)
+	}
+}
+
+func writeOratab(t *testing.T, lines string) string {
+	oratabName := filepath.Join(t.TempDir(), "oratab")
+	if err := os.WriteFile(oratabName, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return oratabName
+}
+
+func sids(entries []Entry) []string {
+	var sids []string
+	for _, entry := range entries {
+		sids = append(sids, entry.SID)
+	}
+	return sids
+}
+
+func TestDatabasesAndLookup(t *testing.T) {
+	setup.PathDelimiter = ":"
+
+	firstName := writeOratab(t, "# oratab\n\n*:/u01/app/19c:N\n+ASM:/u01/app/grid:N\n-MGMTDB:/u01/app/grid:N\nORCL:/u01/app/19c:Y\nTEST:/u01/app/12c:N\n")
+	secondName := writeOratab(t, "ORCL:/u01/app/21c:Y\nDEV:/u01/app/21c:Y\n")
+
+	oratab := Read(firstName + ":" + filepath.Join(t.TempDir(), "missing") + ":" + secondName)
+
+	if len(oratab.Entries) != 7 {
+		t.Fatalf("Read %d entries not 7", len(oratab.Entries))
+	}
+	if entry := oratab.Entries[3]; entry.FileName != firstName || entry.LineNo != 6 {
+		t.Fatalf("ORCL entry is from %s line %d", entry.FileName, entry.LineNo)
+	}
+
+	// The first entry for a SID wins and non databases are skipped
+	if databases := sids(oratab.Databases()); !reflect.DeepEqual(databases, []string{"ORCL", "TEST", "DEV"}) {
+		t.Fatalf("Databases are %v", databases)
+	}
+	if entries := oratab.Lookup("ORCL"); len(entries) != 2 || entries[0].Home != "/u01/app/19c" || entries[1].Home != "/u01/app/21c" {
+		t.Fatalf("Lookup ORCL gave %+v", entries)
+	}
+	for _, sid := range []string{"PROD", "orcl", ""} {
+		if entries := oratab.Lookup(sid); len(entries) != 0 {
+			t.Fatalf("Lookup %q gave %+v", sid, entries)
+		}
+	}
+}
+
+func TestHasRMAN(t *testing.T) {
+	setup.ExecutableSuffix = ""
+
+	home := t.TempDir()
+	entry := Entry{SID: "ORCL", Home: home}
+	if entry.HasRMAN() {
+		t.Fatalf("Home %s has no rman", home)
+	}
+	if err := os.MkdirAll(filepath.Join(home, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry.RMAN(), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !entry.HasRMAN() {
+		t.Fatalf("Home %s has rman", home)
+	}
+}
@@ -3,9 +3,13 @@ package resource
 // Standard imports
 
 import "bufio"
+import "fmt"
 import "os"
+import "path/filepath"
+import "sort"
 import "strconv"
 import "strings"
+import "sync"
 import "time"
 
 // Local imports
@@ -15,20 +19,398 @@ import "github.com/daviesluke/logger"
 import "github.com/daviesluke/setup"
 import "github.com/daviesluke/utils"
 import "github.com/daviesluke/run_rman/config"
+import "github.com/daviesluke/run_rman/coordinator"
+import "github.com/daviesluke/run_rman/metrics"
 //import "github.com/daviesluke/mitchellh/go-ps"
 
 
 // local Variables
 
+//
+// Each line of the usage file is "NAME:UNITS:HOST:PID:STATE:PRIORITY:QUEUED:DB:SCRIPT:SINCE"
+// STATE is HELD for units held or WAIT for units still wanted by a waiting process
+// Waiters are served highest PRIORITY first then oldest QUEUED (unix nanoseconds)
+// DB, SCRIPT and SINCE (unix seconds) are only there to report who holds what
+// Older "NAME:UNITS:HOST:PID" and "NAME:UNITS:HOST:PID:WAIT:PRIORITY:QUEUED" lines are still read
+// Held lines are also written to the obtained file of the process so they can be released
+//
+
+type usageEntry struct {
+	Name     string
+	Units    int
+	Host     string
+	PID      string
+	Waiting  bool
+	Priority int
+	Queued   int64
+	Database string
+	Script   string
+	Since    int64
+}
+
+// Closed to end lease renewal - nil when no renewer is running
+
+var leaseStop  chan struct{}
+var leaseMutex sync.Mutex
+
+var queuedTime int64
+
 // Local functions
 
-func getResource ( resourceName string, resourceValue int, timeOutMins int) {
-	logger.Infof("Resource Name  : %s", resourceName)
-	logger.Infof("Resource Value : %d", resourceValue)
-	logger.Infof("Time out       : %d mins", timeOutMins)
+func parseUsageEntry (usageLine string) (usageEntry, bool) {
+	var entry usageEntry
+
+	usageTokens := strings.Split(strings.TrimSpace(usageLine), ":")
+
+	if len(usageTokens) < 2 {
+		return entry, false
+	}
+
+	var err error
+
+	entry.Name = usageTokens[0]
+
+	if entry.Units, err = strconv.Atoi(usageTokens[1]); err != nil {
+		return entry, false
+	}
+
+	if len(usageTokens) >= 4 {
+		entry.Host = usageTokens[2]
+		entry.PID  = usageTokens[3]
+	}
+
+	if len(usageTokens) >= 7 {
+		entry.Waiting     = usageTokens[4] == "WAIT"
+		entry.Priority, _ = strconv.Atoi(usageTokens[5])
+		entry.Queued, _   = strconv.ParseInt(usageTokens[6], 10, 64)
+	}
+
+	if len(usageTokens) >= 10 {
+		entry.Database  = usageTokens[7]
+		entry.Script    = usageTokens[8]
+		entry.Since, _  = strconv.ParseInt(usageTokens[9], 10, 64)
+	}
+
+	return entry, true
+}
+
+func (entry usageEntry) String() string {
+	usageState := "HELD"
+
+	if entry.Waiting {
+		usageState = "WAIT"
+	}
+
+	usageTokens := []string{ entry.Name, strconv.Itoa(entry.Units), entry.Host, entry.PID, usageState, strconv.Itoa(entry.Priority), strconv.FormatInt(entry.Queued, 10), entry.Database, entry.Script, strconv.FormatInt(entry.Since, 10) }
+
+	return strings.Join(usageTokens, ":")
+}
+
+func newUsageEntry (resourceName string, resourceValue int, waiting bool) usageEntry {
+	// The script name is free text so keep it from breaking up the line
+
+	scriptName := strings.Replace(config.RMANScriptBase, ":", "_", -1)
+
+	entry := usageEntry{ Name: resourceName, Units: resourceValue, Host: setup.HostName, PID: setup.CurrentPID, Waiting: waiting, Priority: setup.Priority, Queued: queuedTime, Database: setup.Database, Script: scriptName, Since: time.Now().Unix() }
+
+	// Waiters report how long they have been queued
+
+	if waiting {
+		entry.Since = queuedTime / int64(time.Second)
+	}
+
+	return entry
+}
+
+func (entry usageEntry) isOwn() bool {
+	return entry.PID == setup.CurrentPID && entry.Host == setup.HostName
+}
+
+func readUsage () []string {
+	logger.Debugf("Reading usage file %s ...", setup.ResourceUsageFileName)
+
+	var usageLines []string
+
+	if usageFile, err := os.Open(setup.ResourceUsageFileName); err == nil {
+		usageScanner := bufio.NewScanner(usageFile)
+
+		for usageScanner.Scan() {
+			usageLines = append(usageLines, usageScanner.Text())
+		}
+
+		usageFile.Close()
+	} else {
+		logger.Debugf("Usage file %s not present", setup.ResourceUsageFileName)
+	}
+
+	logger.Debugf("Read %d usage entries", len(usageLines))
+
+	return usageLines
+}
+
+func writeUsage (usageLines []string) {
+	logger.Debugf("Rewriting usage file %s ...", setup.ResourceUsageFileName)
+
+	// Caller holds the usage file lock
+
+	tempFileName := strings.Join( []string { setup.ResourceUsageFileName, ".", setup.CurrentPID }, "")
+
+	if len(usageLines) == 0 {
+		logger.Info("Usage file is empty. Deleting file ...")
+
+		if err := os.Remove(setup.ResourceUsageFileName); err != nil && ! os.IsNotExist(err) {
+			filelock.UnlockFile(setup.ResourceUsageFileName)
+			logger.Errorf("Unable to remove used file %s", setup.ResourceUsageFileName)
+		}
+	} else {
+		if err := utils.WriteLines(tempFileName, usageLines); err != nil {
+			filelock.UnlockFile(setup.ResourceUsageFileName)
+			logger.Errorf("Unable to write file %s - %s", tempFileName, err)
+		}
+
+		if err := os.Rename(tempFileName, setup.ResourceUsageFileName); err != nil {
+			filelock.UnlockFile(setup.ResourceUsageFileName)
+			logger.Errorf("Unable to rename file %s to %s", tempFileName, setup.ResourceUsageFileName)
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+func setWaitEntry (resourceName string, resourceValue int) {
+	logger.Debugf("Setting wait entry for %d units of resource %s ...", resourceValue, resourceName)
+
+	// Caller holds the usage file lock
+	// Replaces any wait entry we have for the resource - zero units removes it
+
+	var usageLines []string
+
+	for _, usageLine := range readUsage() {
+		if entry, ok := parseUsageEntry(usageLine); ok && entry.Waiting && entry.isOwn() && entry.Name == resourceName {
+			continue
+		}
+
+		usageLines = append(usageLines, usageLine)
+	}
+
+	if resourceValue > 0 {
+		usageLines = append(usageLines, newUsageEntry(resourceName, resourceValue, true).String())
+	}
+
+	writeUsage(usageLines)
+
+	logger.Debug("Process complete")
+}
+
+func removeWaitEntries (waitHost string, waitPID string) {
+	logger.Debugf("Removing wait entries for PID %s on host %s ...", waitPID, waitHost)
+
+	// Caller holds the usage file lock
+
+	var usageLines []string
+
+	removeCount := 0
+
+	for _, usageLine := range readUsage() {
+		if entry, ok := parseUsageEntry(usageLine); ok && entry.Waiting && entry.PID == waitPID && entry.Host == waitHost {
+			removeCount++
+			continue
+		}
+
+		usageLines = append(usageLines, usageLine)
+	}
+
+	if removeCount > 0 {
+		writeUsage(usageLines)
+	}
+
+	logger.Debugf("Removed %d wait entries", removeCount)
+}
+
+func obtainedOwner (fileName string) (string, string) {
+	// Obtained files are named <resources>.obtained.<host>.<pid>
+	// Files written before hosts were recorded have no host part and are taken as local
+
+	obtainedPrefix := strings.Join( []string{ setup.ResourceBaseName, setup.ObtainedResSuffix, "" }, ".")
+
+	ownerString := strings.TrimPrefix(filepath.Base(fileName), obtainedPrefix)
+
+	if dotIndex := strings.LastIndex(ownerString, "."); dotIndex != -1 {
+		return ownerString[:dotIndex], ownerString[dotIndex+1:]
+	}
+
+	return setup.HostName, ownerString
+}
+
+func queuePosition (usageLines []string, resourceName string) (int, int) {
+	var resourceQueue []usageEntry
+
+	for _, usageLine := range usageLines {
+		if entry, ok := parseUsageEntry(usageLine); ok && entry.Waiting && entry.Name == resourceName {
+			resourceQueue = append(resourceQueue, entry)
+		}
+	}
+
+	// Highest priority first and then first come first served
+
+	sort.SliceStable(resourceQueue, func(i, j int) bool {
+		if resourceQueue[i].Priority != resourceQueue[j].Priority {
+			return resourceQueue[i].Priority > resourceQueue[j].Priority
+		}
+		return resourceQueue[i].Queued < resourceQueue[j].Queued
+	})
+
+	for queueIndex, entry := range resourceQueue {
+		if entry.isOwn() {
+			return queueIndex + 1, len(resourceQueue)
+		}
+	}
+
+	return 0, len(resourceQueue)
+}
+
+func joinQueue (resourceName string, resourceValue int) {
+	logger.Infof("Joining queue for %d units of resource %s with priority %d ...", resourceValue, resourceName, setup.Priority)
+
+	if queuedTime == 0 {
+		queuedTime = time.Now().UnixNano()
+	}
+
+	// The obtained file is created now so that a dead waiter can be found and cleaned out
+
+	if resourceObtainedFile , err := os.OpenFile(setup.ResourceObtainedFileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
+		resourceObtainedFile.Close()
+	} else {
+		logger.Errorf("Unable to create resource obtained file %s", setup.ResourceObtainedFileName)
+	}
+
+	filelock.LockFile(setup.ResourceUsageFileName,1)
+
+	setWaitEntry(resourceName, resourceValue)
+
+	filelock.UnlockFile(setup.ResourceUsageFileName)
+
+	logger.Debug("Process complete")
+}
+
+func coordinatorResource ( resourceName string, resourceValue int, timeOut time.Duration) {
+	logger.Infof("Requesting %d units of resource %s from coordinator ...", resourceValue, resourceName)
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	remainingResource := resourceValue
+
+	for attempt := 0; remainingResource > 0; attempt++ {
+		grantedResource, queuePosition, queueLength := coordinator.Acquire(resourceName, remainingResource)
+
+		remainingResource -= grantedResource
+		logger.Debugf("Remaining resource to be allocated - %d", remainingResource)
+
+		if remainingResource > 0 {
+			logger.Infof("Waiting for resource %s - queue position %d of %d", resourceName, queuePosition, queueLength)
+
+			logger.Info("Resource allocation incomplete")
+
+			if ! utils.PollWait("", attempt, deadline, pollInterval, pollMax) {
+				logger.Warnf("Timed Out!")
+				coordinator.Release()
+				logger.Errorf("Unable to obtain %d units for resource %s", resourceValue, resourceName)
+			}
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+func coordinatorAllResources ( resources map[string]int, timeOut time.Duration) {
+	logger.Info("Requesting all resources together from coordinator ...")
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	for attempt := 0; ; attempt++ {
+		gotAll, resourceName, queuePosition, queueLength := coordinator.AcquireAll(resources)
+
+		if gotAll {
+			logger.Info("All resources allocated")
+			break
+		}
+
+		logger.Infof("Waiting for resource %s - queue position %d of %d", resourceName, queuePosition, queueLength)
+
+		logger.Info("Resources not all available")
+
+		if ! utils.PollWait("", attempt, deadline, pollInterval, pollMax) {
+			logger.Warnf("Timed Out!")
+			coordinator.Release()
+			logger.Errorf("Unable to obtain all requested resources")
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+func startLease () {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+
+	if leaseStop != nil {
+		logger.Debug("Lease already being renewed")
+		return
+	}
+
+	leaseSecs, _ := strconv.Atoi(config.ConfigValues["LeaseSecs"])
+
+	// The obtained file modification time is our lease - other hosts check its age
+
+	renewInterval := time.Duration(leaseSecs) * time.Second / 3
+
+	if renewInterval <= 0 {
+		logger.Warn("LeaseSecs is not positive - resource lease will not be renewed")
+		return
+	}
+
+	leaseStop = make(chan struct{})
+
+	go keepLease(renewInterval, leaseStop)
+}
+
+func stopLease () {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+
+	if leaseStop != nil {
+		logger.Debug("Stopping resource lease renewal")
+		close(leaseStop)
+		leaseStop = nil
+	}
+}
+
+func keepLease (renewInterval time.Duration, stop chan struct{}) {
+	renewTicker := time.NewTicker(renewInterval)
+	defer renewTicker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-renewTicker.C:
+			currentTime := time.Now()
+
+			if err := os.Chtimes(setup.ResourceObtainedFileName, currentTime, currentTime); err != nil {
+				logger.Debugf("Unable to renew lease on %s - %s", setup.ResourceObtainedFileName, err)
+			}
+		}
+	}
+}
+
+func checkCapacity ( resourceName string, resourceValue int ) int {
+	logger.Debugf("Checking capacity of resource %s ...", resourceName)
 
 	var imaxResource  int
-	var iusedResource int
 	var err           error
 
 	// First check there is a resource file present
@@ -56,55 +438,179 @@ func getResource ( resourceName string, resourceValue int, timeOutMins int) {
 		logger.Errorf("Resource %s has maximum value %d, attempting to get %d", resourceName, imaxResource, resourceValue)
 	}
 
-	resourceCounter   := 0
-	remainingResource := resourceValue
-	
-	for allocatedResource := 0; resourceValue - allocatedResource > 0; {
-		logger.Debugf("Remaining resource - %d", remainingResource)
-		logger.Debugf("Allocated resource - %d", allocatedResource)
+	logger.Debug("Process complete")
 
-		// Check to see of any resources are currently being used 
+	return imaxResource
+}
 
-		iusedResource  = 0
+func usedResource ( usageLines []string, resourceName string ) int {
+	// Caller holds the usage file lock
 
-		// Check if used file exists and clean it 
+	iusedResource := 0
 
-		if _, err = os.Stat(setup.ResourceUsageFileName); err == nil {
-			// Clean up resource file just in case there are old entries
+	for _, usageLine := range usageLines {
+		entry, ok := parseUsageEntry(usageLine)
+		if ! ok {
+			filelock.UnlockFile(setup.ResourceUsageFileName)
+			logger.Errorf("Resource entry not configured properly in %s with value %s", setup.ResourceUsageFileName, usageLine)
+		}
+
+		if entry.Name == resourceName && ! entry.Waiting {
+			logger.Debugf("Found %d units used", entry.Units)
+
+			iusedResource+=entry.Units
+			logger.Debugf("Cumulative units used - %d", iusedResource)
+		}
+	}
+
+	return iusedResource
+}
+
+func getAllResources ( resources map[string]int, timeOut time.Duration) {
+	logger.Info("Allocating all resources together ...")
+	logger.Infof("Time out       : %s", timeOut)
+
+	// Sorted so the log and the usage file entries are always in the same order
+
+	var resourceNames []string
+
+	maxResources := make(map[string]int)
+
+	for resourceName, resourceValue := range resources {
+		logger.Infof("Resource %s : %d units", resourceName, resourceValue)
+
+		maxResources[resourceName] = checkCapacity(resourceName, resourceValue)
+
+		resourceNames = append(resourceNames, resourceName)
+	}
+
+	sort.Strings(resourceNames)
+
+	for _, resourceName := range resourceNames {
+		joinQueue(resourceName, resources[resourceName])
+	}
+
+	// Work out the deadline once we are queued so the wait covers the whole allocation
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	for attempt := 0; ; attempt++ {
+		// Check if used file exists and clean it 
 
+		if _, err := os.Stat(setup.ResourceUsageFileName); err == nil {
 			cleanResources()
 		}
 
-		// Lock the usage file to prevent anyone else using the file
+		// Everything is decided and taken under a single lock of the usage file
 
 		filelock.LockFile(setup.ResourceUsageFileName,1)
-	
-		// Check again as after the clean the file may have been removed
 
-		if _, err = os.Stat(setup.ResourceUsageFileName); err == nil {
-		
-			usedResource  := utils.LookupFile(setup.ResourceUsageFileName, resourceName, 1, 2, ":", 1)
+		usageLines := readUsage()
 
-			// Loop through used file looking for usage 
+		allFit := true
 
-			for usedCounter := 2; usedResource != ""; usedCounter++ {
-				logger.Debugf("Found %s units used", usedResource)
-				if usedAmount, err := strconv.Atoi(usedResource); err != nil {
-					filelock.UnlockFile(setup.ResourceUsageFileName)
-					logger.Errorf("Resource %s not configured properly in %s with value %s", resourceName, setup.ResourceUsageFileName, usedResource)
-				} else {
-					iusedResource+=usedAmount
-					logger.Debugf("Cumulative units used - %d", iusedResource)
-				}
+		for _, resourceName := range resourceNames {
+			freeResource := maxResources[resourceName] - usedResource(usageLines, resourceName)
+			logger.Debugf("Amount of free resource %s is %d", resourceName, freeResource)
+
+			if freeResource < 0 {
+				filelock.UnlockFile(setup.ResourceUsageFileName)
+				logger.Errorf("Resource calculation got negative resources. Fix resource allocation files. Exiting with error ...")
+			}
+
+			resourcePosition, queueLength := queuePosition(usageLines, resourceName)
+
+			if resourcePosition == 0 {
+				logger.Warnf("Queue entry for resource %s has been removed. Rejoining queue ...", resourceName)
+
+				setWaitEntry(resourceName, resources[resourceName])
 
-				// Get next one 
+				usageLines = readUsage()
 
-				logger.Debugf("Looking up %d occurrence ...", usedCounter)
+				allFit = false
+			} else if resourcePosition != 1 {
+				logger.Infof("Waiting for resource %s - queue position %d of %d", resourceName, resourcePosition, queueLength)
 
-				usedResource = utils.LookupFile(setup.ResourceUsageFileName, resourceName, 1, 2, ":", usedCounter)
+				allFit = false
+			} else if freeResource < resources[resourceName] {
+				logger.Infof("Only %d of %d units of resource %s available - queue position %d of %d", freeResource, resources[resourceName], resourceName, resourcePosition, queueLength)
+
+				allFit = false
 			}
 		}
 
+		if allFit {
+			logger.Info("All resources available. Allocating ...")
+
+			for _, resourceName := range resourceNames {
+				addResource(resourceName, resources[resourceName])
+
+				setWaitEntry(resourceName, 0)
+			}
+		}
+
+		// Unlock the usage file
+
+		filelock.UnlockFile(setup.ResourceUsageFileName)
+
+		if allFit {
+			break
+		}
+
+		logger.Info("Resources not all available")
+
+		// Woken early if the usage file changes e.g. another process releases its units
+
+		if ! utils.PollWait(setup.ResourceUsageFileName, attempt, deadline, pollInterval, pollMax) {
+			logger.Warnf("Timed Out!")
+			ReleaseResources(setup.ResourceObtainedFileName)
+			logger.Errorf("Unable to obtain all requested resources")
+		}
+	}
+
+	logger.Debug("Process complete")
+}
+
+func getResource ( resourceName string, resourceValue int, timeOut time.Duration) {
+	logger.Infof("Resource Name  : %s", resourceName)
+	logger.Infof("Resource Value : %d", resourceValue)
+	logger.Infof("Time out       : %s", timeOut)
+
+	var iusedResource int
+	var err           error
+
+	imaxResource := checkCapacity(resourceName, resourceValue)
+
+	remainingResource := resourceValue
+
+	joinQueue(resourceName, resourceValue)
+
+	deadline     := time.Now().Add(timeOut)
+	pollInterval := config.GetDuration("PollInterval", time.Second)
+	pollMax      := config.GetDuration("PollMaxInterval", time.Second)
+
+	for allocatedResource, attempt := 0, 0; resourceValue - allocatedResource > 0; attempt++ {
+		logger.Debugf("Remaining resource - %d", remainingResource)
+		logger.Debugf("Allocated resource - %d", allocatedResource)
+
+		// Check if used file exists and clean it 
+
+		if _, err = os.Stat(setup.ResourceUsageFileName); err == nil {
+			// Clean up resource file just in case there are old entries
+
+			cleanResources()
+		}
+
+		// Lock the usage file to prevent anyone else using the file
+
+		filelock.LockFile(setup.ResourceUsageFileName,1)
+
+		usageLines := readUsage()
+
+		iusedResource = usedResource(usageLines, resourceName)
+
 		freeResource := imaxResource - iusedResource
 		logger.Debugf("Amount of free resource is %d", freeResource)
 
@@ -113,10 +619,18 @@ func getResource ( resourceName string, resourceValue int, timeOutMins int) {
 			logger.Errorf("Resource calculation got negative resources. Fix resource allocation files. Exiting with error ...")
 		}
 
-		if freeResource == 0 {
-			logger.Infof("No resources of type %s currently available", resourceName)
+		// Only the head of the queue may allocate so later arrivals cannot starve it
+
+		resourcePosition, queueLength := queuePosition(usageLines, resourceName)
 
-			resourceCounter++
+		if resourcePosition == 0 {
+			logger.Warnf("Queue entry for resource %s has been removed. Rejoining queue ...", resourceName)
+
+			setWaitEntry(resourceName, remainingResource)
+		} else if resourcePosition != 1 {
+			logger.Infof("Waiting for resource %s - queue position %d of %d", resourceName, resourcePosition, queueLength)
+		} else if freeResource == 0 {
+			logger.Infof("No resources of type %s currently available - queue position %d of %d", resourceName, resourcePosition, queueLength)
 		} else {
 			if remainingResource <= freeResource {
 				logger.Infof("Allocating all needed resources for %s", resourceName)
@@ -132,8 +646,11 @@ func getResource ( resourceName string, resourceValue int, timeOutMins int) {
 
 				allocatedResource += freeResource
 				remainingResource -= freeResource
-				resourceCounter++
 			}
+
+			// Keep our place at the head of the queue for anything still outstanding
+
+			setWaitEntry(resourceName, remainingResource)
 		} 
 
 		// Unlock the usage file
@@ -143,14 +660,15 @@ func getResource ( resourceName string, resourceValue int, timeOutMins int) {
 		logger.Debugf("Remaining resource to be allocated - %d", remainingResource)
 
 		if remainingResource > 0 {
-			if resourceCounter > timeOutMins {
+			logger.Info("Resource allocation incomplete")
+
+			// Woken early if the usage file changes e.g. another process releases its units
+
+			if ! utils.PollWait(setup.ResourceUsageFileName, attempt, deadline, pollInterval, pollMax) {
 				logger.Warnf("Timed Out!")
 				ReleaseResources(setup.ResourceObtainedFileName)
 				logger.Errorf("Unable to obtain %d units for resource %s", resourceValue, resourceName)
 			}
-
-			logger.Info("Resource allocation incomplete.  Sleeping for 60 secs ...")
-			time.Sleep(60 * time.Second)
 		}
 	}
 
@@ -167,7 +685,9 @@ func addResource(resourceName string, resourceValue int) {
 
 	// Write string to both files
 
-	writeString := strings.Join( []string{ resourceName, ":", strconv.Itoa(resourceValue) }, "")
+	// Host and PID identify the holder - the lines are kept identical in both files so they can be matched on release
+
+	writeString := newUsageEntry(resourceName, resourceValue, false).String()
 
 	// Write to Used file
 
@@ -279,26 +799,54 @@ func cleanResources() {
 
 	// Open config directory ( location of resource files )
 
-	regEx := strings.Join( []string{ "^", setup.BaseName, "\\.", setup.ResourceSuffix, "\\.", setup.ObtainedResSuffix, "\\.[0-9]+$" }, "" )
+	// Obtained files live beside the usage file
+
+	obtainedDir := filepath.Dir(setup.ResourceUsageFileName)
+
+	regEx := strings.Join( []string{ "^", setup.BaseName, "\\.", setup.ResourceSuffix, "\\.", setup.ObtainedResSuffix, "\\.(.+\\.)?[0-9]+$" }, "" )
 	logger.Debugf("Regular expression set to %s", regEx)
 
-	fileList := utils.FindFiles(setup.ConfigDir, regEx, 0) 
+	leaseSecs, err := strconv.Atoi(config.ConfigValues["LeaseSecs"])
+	if err != nil {
+		logger.Errorf("LeaseSecs configuration is not an integer")
+	}
+
+	fileList := utils.FindFiles(obtainedDir, regEx, 0) 
 
 	for _, fileName := range fileList {
 		logger.Infof("Found file %s. Checking it is an obsolete process ...", fileName)
 
-		// Getting process ID from file name 
+		// Getting host and process ID from file name 
 
-		partString := strings.Split(fileName,".")
-		pidString  := partString[len(partString)-1]
+		hostString, pidString := obtainedOwner(fileName)
 
-		if pidString != setup.CurrentPID {
+		if pidString == setup.CurrentPID && hostString == setup.HostName {
+			logger.Debug("File found is from current PID. Ignoring ...")
+			continue
+		}
 
-			pid , err := strconv.Atoi(pidString)
-			if err != nil {
-				logger.Errorf("Unable to convert %s to a number", pidString)
-			}
+		pid , err := strconv.Atoi(pidString)
+		if err != nil {
+			logger.Errorf("Unable to convert %s to a number", pidString)
+		}
+
+		if hostString != setup.HostName {
+			// Cannot check another host's processes - rely on the lease being renewed
+
+			if fileInfo, err := os.Stat(fileName); err == nil {
+				leaseAge := time.Since(fileInfo.ModTime())
 
+				if leaseAge <= time.Duration(leaseSecs) * time.Second {
+					logger.Infof("Process %d on host %s holds a current lease.  Ignoring ...", pid, hostString)
+					continue
+				}
+
+				logger.Warnf("Process %d on host %s has not renewed its lease for %0.0f seconds. Releasing resources ...", pid, hostString, leaseAge.Seconds())
+			} else {
+				logger.Infof("File %s already removed", fileName)
+				continue
+			}
+		} else {
 			// Check that process is not currently running
 			
 			if pidAlive, pidIsName := utils.CheckProcess(pid, setup.BaseName); pidAlive {
@@ -311,11 +859,9 @@ func cleanResources() {
 			} else {
 				logger.Warnf("Found old PID %d not currently running. Releasing resources ...", pid)
 			}
-					
-			ReleaseResources(fileName)
-		} else {
-			logger.Debug("File found is from current PID. Ignoring ...")
 		}
+					
+		ReleaseResources(fileName)
 	}
 
 	logger.Debug("Process complete")
@@ -330,16 +876,45 @@ func GetResources ( resources map[string]int ) {
 
 	resourceCount := 0
 
-	checkResourceMins, _ := strconv.Atoi(config.ConfigValues["CheckResourceMins"])
+	checkResourceTimeout := config.GetTimeout("CheckResourceTimeout", "CheckResourceMins")
 
-	for resourceName, resourceValue := range resources {
-		logger.Infof("Checking resource %s, attempting to allocate %d units ...", resourceName, resourceValue)
+	// Partial mode takes whatever is free for each resource in turn and holds it while waiting
+	// Otherwise nothing is taken until every resource requested fits
 
-		getResource(resourceName, resourceValue, checkResourceMins)
-	
-		resourceCount++
+	partialResources := utils.CheckRegEx(config.ConfigValues["PartialResources"], "^[YyTt]")
+
+	// Other hosts can only tell we are alive by the lease being kept up to date - waiting or not
+
+	if ! coordinator.Enabled() && len(resources) > 0 {
+		startLease()
 	}
 
+	metrics.StartWait("resource")
+
+	if partialResources || len(resources) == 0 {
+		for resourceName, resourceValue := range resources {
+			logger.Infof("Checking resource %s, attempting to allocate %d units ...", resourceName, resourceValue)
+
+			if coordinator.Enabled() {
+				coordinatorResource(resourceName, resourceValue, checkResourceTimeout)
+			} else {
+				getResource(resourceName, resourceValue, checkResourceTimeout)
+			}
+		
+			resourceCount++
+		}
+	} else {
+		if coordinator.Enabled() {
+			coordinatorAllResources(resources, checkResourceTimeout)
+		} else {
+			getAllResources(resources, checkResourceTimeout)
+		}
+
+		resourceCount = len(resources)
+	}
+
+	metrics.EndWait("resource")
+
 	if resourceCount == 0 {
 		logger.Info("No resources to provision")
 	}
@@ -347,9 +922,27 @@ func GetResources ( resources map[string]int ) {
 	logger.Info("Process complete")
 }
 
+func ReleaseProcessResources() {
+	logger.Info("Releasing resources held by this process ...")
+
+	if coordinator.Enabled() {
+		coordinator.Release()
+	} else {
+		ReleaseResources(setup.ResourceObtainedFileName)
+	}
+
+	logger.Info("Process complete")
+}
+
 func ReleaseResources(resFileName string) {
 	logger.Info("Releasing resources ...")
 
+	// Only our own obtained file has a lease being renewed - others are cleaned for dead processes
+
+	if resFileName == setup.ResourceObtainedFileName {
+		stopLease()
+	}
+
 	// Need to get file lock to affect these files
 
 	// Lock the usage file to prevent anyone else using the file
@@ -380,9 +973,208 @@ func ReleaseResources(resFileName string) {
 		logger.Warnf("Unable to open file %s.  Nothing to do", resFileName)
 	}
 
+	// A process may still be queued for more
+
+	waitHost, waitPID := obtainedOwner(resFileName)
+
+	removeWaitEntries(waitHost, waitPID)
+
 	// Unlock the usage file
 
 	filelock.UnlockFile(setup.ResourceUsageFileName)
 	
 	logger.Info("Process complete")
 }
+
+func ShowResources () {
+	logger.Info("Showing resource usage ...")
+
+	if coordinator.Enabled() {
+		logger.Errorf("Resources are managed by the coordinator at %s and not the usage file", config.ConfigValues["CoordinatorAddress"])
+	}
+
+	// Capacity comes from the resource file - anything only in the usage file is still shown
+
+	var resourceNames []string
+
+	resourceCapacity := make(map[string]string)
+
+	if resourceFile, err := os.Open(setup.ResourceFileName); err == nil {
+		resourceScanner := bufio.NewScanner(resourceFile)
+
+		for resourceScanner.Scan() {
+			resourceLine := strings.TrimSpace(resourceScanner.Text())
+
+			if resourceLine == "" || resourceLine[0] == '#' {
+				continue
+			}
+
+			resourceTokens := strings.SplitN(resourceLine, ":", 2)
+
+			if len(resourceTokens) != 2 {
+				logger.Warnf("Ignoring invalid resource line %s", resourceLine)
+				continue
+			}
+
+			resourceName := strings.TrimSpace(resourceTokens[0])
+
+			resourceCapacity[resourceName] = strings.TrimSpace(resourceTokens[1])
+			resourceNames = append(resourceNames, resourceName)
+		}
+
+		resourceFile.Close()
+	} else {
+		logger.Warnf("Unable to open resource file %s", setup.ResourceFileName)
+	}
+
+	// Clear out dead processes first so only real holders are shown
+
+	if _, err := os.Stat(setup.ResourceUsageFileName); err == nil {
+		cleanResources()
+	}
+
+	filelock.LockFile(setup.ResourceUsageFileName,1)
+
+	usageLines := readUsage()
+
+	filelock.UnlockFile(setup.ResourceUsageFileName)
+
+	resourceHolders := make(map[string][]usageEntry)
+	resourceWaiters := make(map[string][]usageEntry)
+
+	for _, usageLine := range usageLines {
+		entry, ok := parseUsageEntry(usageLine)
+		if ! ok {
+			logger.Warnf("Ignoring invalid usage line %s", usageLine)
+			continue
+		}
+
+		if _, nameExists := resourceCapacity[entry.Name]; ! nameExists {
+			resourceCapacity[entry.Name] = "?"
+			resourceNames = append(resourceNames, entry.Name)
+		}
+
+		if entry.Waiting {
+			resourceWaiters[entry.Name] = append(resourceWaiters[entry.Name], entry)
+		} else {
+			resourceHolders[entry.Name] = append(resourceHolders[entry.Name], entry)
+		}
+	}
+
+	sinceString := func (since int64) string {
+		if since == 0 {
+			return "-"
+		}
+
+		return time.Unix(since, 0).Format("2006-01-02 15:04:05")
+	}
+
+	for _, resourceName := range resourceNames {
+		fmt.Printf("Resource %s - capacity %s, used %d\n", resourceName, resourceCapacity[resourceName], usedResource(usageLines, resourceName))
+
+		for _, entry := range resourceHolders[resourceName] {
+			fmt.Printf("  HELD  %4d units  PID %-8s host %-16s db %-10s script %-20s since %s\n", entry.Units, entry.PID, entry.Host, entry.Database, entry.Script, sinceString(entry.Since))
+		}
+
+		// Waiters in the order they will be served
+
+		resourceQueue := resourceWaiters[resourceName]
+
+		sort.SliceStable(resourceQueue, func(i, j int) bool {
+			if resourceQueue[i].Priority != resourceQueue[j].Priority {
+				return resourceQueue[i].Priority > resourceQueue[j].Priority
+			}
+			return resourceQueue[i].Queued < resourceQueue[j].Queued
+		})
+
+		for queueIndex, entry := range resourceQueue {
+			fmt.Printf("  WAIT  %4d units  PID %-8s host %-16s db %-10s script %-20s since %s  position %d priority %d\n", entry.Units, entry.PID, entry.Host, entry.Database, entry.Script, sinceString(entry.Since), queueIndex + 1, entry.Priority)
+		}
+	}
+
+	if len(resourceNames) == 0 {
+		fmt.Println("No resources defined or in use")
+	}
+
+	logger.Info("Process complete")
+}
+
+func ForceReleaseResources (releaseOwner string) {
+	logger.Infof("Forcibly releasing resources held by %s ...", releaseOwner)
+
+	if coordinator.Enabled() {
+		logger.Errorf("Resources are managed by the coordinator at %s. Stop the holding process to release them", config.ConfigValues["CoordinatorAddress"])
+	}
+
+	// Owner is PID for this host or PID@HOST for another
+
+	releasePID  := releaseOwner
+	releaseHost := setup.HostName
+
+	if atIndex := strings.Index(releaseOwner, "@"); atIndex != -1 {
+		releasePID  = releaseOwner[:atIndex]
+		releaseHost = releaseOwner[atIndex+1:]
+	}
+
+	pid, err := strconv.Atoi(releasePID)
+	if err != nil || pid <= 0 {
+		logger.Errorf("Invalid process ID %s. Use PID or PID@HOST", releasePID)
+	}
+
+	if releaseHost == setup.HostName {
+		if pidAlive, pidIsName := utils.CheckProcess(pid, setup.BaseName); pidAlive && pidIsName {
+			logger.Warnf("Process %d is still running. It will carry on as if it holds its resources", pid)
+		}
+	}
+
+	releaseCount := 0
+
+	// Release through the obtained file as the process itself would
+
+	obtainedDir := filepath.Dir(setup.ResourceUsageFileName)
+
+	obtainedFileNames := []string{ filepath.Join(obtainedDir, strings.Join( []string{ setup.ResourceBaseName, setup.ObtainedResSuffix, releaseHost, releasePID }, ".")) }
+
+	if releaseHost == setup.HostName {
+		obtainedFileNames = append(obtainedFileNames, filepath.Join(obtainedDir, strings.Join( []string{ setup.ResourceBaseName, setup.ObtainedResSuffix, releasePID }, ".")))
+	}
+
+	for _, obtainedFileName := range obtainedFileNames {
+		if _, err := os.Stat(obtainedFileName); err == nil {
+			ReleaseResources(obtainedFileName)
+			releaseCount++
+		}
+	}
+
+	// Catch anything left in the usage file without an obtained file
+
+	filelock.LockFile(setup.ResourceUsageFileName,1)
+
+	var usageLines []string
+
+	removeCount := 0
+
+	for _, usageLine := range readUsage() {
+		if entry, ok := parseUsageEntry(usageLine); ok && entry.PID == releasePID && entry.Host == releaseHost {
+			logger.Infof("Removing usage entry %s", usageLine)
+			removeCount++
+			continue
+		}
+
+		usageLines = append(usageLines, usageLine)
+	}
+
+	if removeCount > 0 {
+		writeUsage(usageLines)
+	}
+
+	filelock.UnlockFile(setup.ResourceUsageFileName)
+
+	if releaseCount + removeCount == 0 {
+		logger.Warnf("No resources found for process %s on host %s", releasePID, releaseHost)
+	} else {
+		logger.Infof("Released resources for process %s on host %s", releasePID, releaseHost)
+	}
+
+	logger.Info("Process complete")
+}
@@ -1,6 +1,131 @@
 /* 
 Version History
 
+2026-10-18  Version 2.26.0 Luke
+            With a catalog the database is registered if it is not already (CatalogRegister)
+            and the catalog is resynced after the script (CatalogResync), both run through
+            RMAN.  -catalog lists the catalog's databases with their last resync and backup,
+            flagging any stale or behind the control file, and exits with 2 if so
+
+2026-10-18  Version 2.25.0 Luke
+            Connections are parsed once for both the connection checks and RMAN.  Wallet
+            aliases (/@ALIAS), roles such as as sysbackup and quoted passwords are supported
+            and TnsAdmin sets TNS_ADMIN for the checks and RMAN
+
+2026-10-18  Version 2.24.0 Luke
+            EnvFile is sourced for the SID in a subshell and the Oracle variables it sets
+            (ORACLE_HOME, TNS_ADMIN, library paths, NLS_* etc.) are used for the connection
+            checks and RMAN.  Its ORACLE_HOME is used without needing an oratab entry
+
+2026-10-18  Version 2.23.0 Luke
+            Oratab files are read by a parser giving the SID, home, start flag and comment.
+            Trailing comments and Windows drive letters are handled and an entry is only
+            used if its home contains bin/rman.  ORACLE_HOME from the environment is now
+            used correctly when the SID is not in an oratab
+
+2026-10-18  Version 2.22.0 Luke
+            -d ALL runs every database in the oratab files (not flagged N, no ASM) and
+            -d DB1,DB2 a list.  Each database runs as its own run_rman, FleetConcurrency
+            at a time, with its own log, lock and history and one summary e-mail
+
+2026-10-18  Version 2.21.0 Luke
+            -validate generates and runs restore database, archivelog and optionally
+            controlfile validate for the last ValidateDays days in place of a script.
+            Runs through the normal lock, resource and config handling and has its own
+            history entries under the script name validate
+
+2026-10-18  Version 2.20.0 Luke
+            -report prints the last level 0, level 1 and archivelog backups, datafiles not
+            backed up, archive log gaps and the earliest recoverable point.  Exits with 2 if
+            any Report* threshold is breached so it can be used as a monitoring check
+
+2026-10-18  Version 2.19.0 Luke
+            BackupOn=PRIMARY|STANDBY|ANY checks the database role before locking and exits
+            with status SKIPPED in the history when it does not match.  Config entries can
+            now be set per script as SCRIPT_Name or SID_SCRIPT_Name
+
+2026-10-18  Version 2.18.0 Luke
+            Pre-flight checks of open mode and role, archive log mode, block change
+            tracking, recovery area usage and running RMAN sessions, chosen per SID
+            with PreflightChecks
+
+2026-10-18  Version 2.17.0 Luke
+            After the script RMAN's own record of the job is checked in v$rman_status and
+            v$rman_backup_job_details.  FAILED or COMPLETED WITH ERRORS fails the run and
+            the bytes read and written, compression ratio and job seconds go into the
+            history and e-mail
+
+2026-10-18  Version 2.16.0 Luke
+            After each run a Prometheus textfile collector file is written to MetricsDir with
+            last run and success times, duration, status, bytes, lock and resource wait
+            seconds and a total of RMAN errors
+
+2026-10-18  Version 2.15.0 Luke
+            Runs are compared with the median and spread of earlier successful runs of the
+            same script. A warning is logged, and added to the e-mail subject, when a run is
+            slow or is still going past the expected time (SlowRunFactor, SlowRunMinRuns,
+            SlowRunHistory)
+
+2026-10-18  Version 2.14.0 Luke
+            Each run is recorded in a JSON lines history store (run_rman.history in the log
+            directory) with times, status, error codes and bytes backed up
+            Added -history [-d DB] [-script NAME] [-since 7d] to show runs, success rate and
+            average duration per script
+
+2026-10-18  Version 2.13.0 Luke
+            RMAN connections are passed on its standard input rather than written into the
+            command file, so no credentials are stored on disk during the run
+
+2026-10-18  Version 2.12.0 Luke
+            Passwords in connection strings and after "identified by" are masked in every
+            log line, including copied command files, with extra patterns in RedactPatterns
+
+2026-10-18  Version 2.11.0 Luke
+            The log file can be rotated by size (RLOG_LOG_MAX_SIZE in the log config) keeping
+            a number of segments, optionally gzipped. Old segments are removed with the logs
+
+2026-10-18  Version 2.10.0 Luke
+            Log lines can be sent to syslog (SyslogLogLevel) and the systemd journal
+            (JournalLogLevel) with database, script, status and phase fields
+
+2026-10-18  Version 2.9.0 Luke
+            Log lines can also go to stderr at their own level (StderrLogLevel) while the
+            log file keeps its level
+
+2026-10-18  Version 2.8.0 Luke
+            Log lines may be written as JSON or logfmt (RLOG_LOG_FORMAT in the log config)
+            with database, script and phase fields on every line
+
+2026-10-18  Version 2.7.0 Luke
+            Logging uses its own rlog Logger instead of setting RLOG_* environment
+            variables, so they no longer leak into the RMAN environment
+
+2026-10-18  Version 2.6.0 Luke
+            Added -resources to show resource capacity, holders and waiters and
+            -releaseresources PID[@HOST] to forcibly release a holder's allocation
+            Usage file entries now record the database, script and start time
+
+2026-10-18  Version 2.5.0 Luke
+            Lock and resource time outs may be durations (CheckLockTimeout, CheckResourceTimeout)
+            and are measured against a deadline rather than counting minute long sleeps
+            Waits back off from PollInterval to PollMaxInterval with jitter and wake early
+            when the lock or usage file changes
+
+2026-10-18  Version 2.4.0 Luke
+            Multiple resources are now taken together under one lock of the usage file
+            and nothing is held until everything fits, avoiding deadlocks between jobs
+            Set PartialResources=Y for the old one resource at a time behaviour
+
+2026-10-18  Version 2.3.0 Luke
+            Lock and resource waiters queue in the lock and usage files (and in the daemon)
+            and are served in order of arrival. Added -p | -priority to jump the queue
+            Queue position is logged on each poll
+
+2026-10-18  Version 2.2.0 Luke
+            Lock and resource entries record the host name so runs on different nodes can share
+            a lock directory (SharedLockDir). Remote entries are judged stale by lease expiry (LeaseSecs)
+            Added -daemon coordination mode (CoordinatorAddress) as an alternative to the files
+
 2019-02-27  Version 2.1.3 Luke
             Minor change to allow log files to be readable by the group
 
@@ -21,6 +146,8 @@ package main
 
 // Standard imports
 
+import "os"
+
 // Local imports
 
 import "github.com/daviesluke/logger"
@@ -28,8 +155,12 @@ import "github.com/daviesluke/setup"
 import "github.com/daviesluke/utils"
 
 import "github.com/daviesluke/run_rman/config"
+import "github.com/daviesluke/run_rman/coordinator"
+import "github.com/daviesluke/run_rman/fleet"
 import "github.com/daviesluke/run_rman/general"
+import "github.com/daviesluke/run_rman/history"
 import "github.com/daviesluke/run_rman/locker"
+import "github.com/daviesluke/run_rman/metrics"
 import "github.com/daviesluke/run_rman/resource"
 import "github.com/daviesluke/run_rman/oracle"
 import "github.com/daviesluke/run_rman/oracle/rman"
@@ -37,7 +168,7 @@ import "github.com/daviesluke/run_rman/oracle/rman"
 // Local Variables
 
 const (
-	version string = "V2.1.3"
+	version string = "V2.26.0"
 )
 
 func main() {
@@ -58,37 +189,170 @@ func main() {
 	// Validate the command line parameters
 	general.ValidateFlags()
 
-	// Check the command script provided
-	config.SetRMANScript()
+	// Run as the lock and resource coordinator if requested - does not return
+	if general.DaemonMode {
+		config.GetConfig(setup.ConfigFileName)
+
+		config.SetAllConfig(setup.Database)
+
+		coordinator.RunDaemon()
+	}
+
+	// Resource administration commands work on the usage file and then exit
+	if general.ShowResources || general.ReleaseOwner != "" {
+		config.GetConfig(setup.ConfigFileName)
+
+		config.SetAllConfig(setup.Database)
+
+		if general.ReleaseOwner != "" {
+			resource.ForceReleaseResources(general.ReleaseOwner)
+		}
+
+		if general.ShowResources {
+			resource.ShowResources()
+		}
+
+		logger.Info("Process complete")
+
+		return
+	}
+
+	// Run history is read from the history store and then exits
+	if general.ShowHistory {
+		history.ShowHistory(setup.HistStoreFileName, setup.Database, general.HistoryScript, general.HistorySince)
+
+		logger.Info("Process complete")
+
+		return
+	}
+
+	// Backup coverage report for monitoring - exits with 2 if a threshold is breached
+	if general.ShowReport {
+		config.GetConfig(setup.ConfigFileName)
+
+		general.SetEnvironment(setup.Database)
+
+		breached := oracle.Report()
+
+		logger.Info("Process complete")
+
+		if breached {
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	// Catalog health for monitoring - exits with 2 if the catalog is stale or behind
+	if general.CheckCatalog {
+		config.GetConfig(setup.ConfigFileName)
+
+		general.SetEnvironment(setup.Database)
+
+		unhealthy := oracle.CatalogHealth()
+
+		logger.Info("Process complete")
+
+		if unhealthy {
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	// Several databases are run as a child process each with a summary at the end
+	if fleet.IsFleet(setup.Database) {
+		if ! general.ValidateMode {
+			config.SetRMANScript()
+		}
+
+		config.GetConfig(setup.ConfigFileName)
+
+		config.SetAllConfig(setup.Database)
+
+		fleetDatabases := fleet.Databases(setup.Database)
+
+		// Children write their own history so only the e-mail subject uses these
+
+		setup.SetDatabase("FLEET")
+
+		logger.SetHistoryVars("", "", setup.Database, config.RMANScriptBase)
+
+		general.RenameLog()
+
+		fleet.Run(fleetDatabases)
+
+		return
+	}
+
+	logger.SetPhase("setup")
+
+	// Check the command script provided or generate one to validate restores
+	if general.ValidateMode {
+		config.SetValidateScript()
+	} else {
+		config.SetRMANScript()
+	}
 
 	// Read the config file 
 	config.GetConfig(setup.ConfigFileName)
 
+	// Write metrics with the history, whether the run succeeds or fails
+	logger.SetHistoryHook(metrics.WriteMetrics)
+
 	// Check and set the environment
 	general.SetEnvironment(setup.Database)
 
+	if general.ValidateMode {
+		rman.WriteValidateScript()
+	}
+
 	// Reset logging to reflect the environment
 	general.RenameLog()
 
+	// Work out how long the run should take from earlier runs
+	history.WatchDuration()
+
+	// Skip the run if the database role does not match BackupOn
+	oracle.CheckPlacement()
+
 	// Lock the process if supplied
+	logger.SetPhase("lock")
 	locker.LockProcess(general.LockName,setup.Database)
 
 	// Set any resources supplied
+	logger.SetPhase("resource")
 	resource.GetResources(general.Resources)
 
 	// Check the connections
+	logger.SetPhase("connect")
 	oracle.CheckConnections()
 
+	// Check the database is fit to back up
+	logger.SetPhase("preflight")
+	oracle.PreflightChecks()
+
+	// Register in the catalog if needed before RMAN is run with it
+	rman.RegisterDatabase()
+
 	// Get RMAN config
+	logger.SetPhase("rman")
 	rman.CheckConfig()
 
 	// Run RMAN command
 	rman.RunScript()
 
+	// Bring the catalog up to date with the control file
+	rman.ResyncCatalog()
+
 	// Reset RMAN config
 	rman.ResetConfig()
 
+	// Warn if the run was slower than usual
+	history.CheckDuration()
+
 	// Perform file removal, lock removal, resources cleanup needed
+	logger.SetPhase("cleanup")
 	general.Cleanup()
 
 	// Write the history file
@@ -47,10 +47,12 @@ var ResourceUsageFileName    string
 var ResourceObtainedFileName string
 var TmpFileName              string
 var HistFileName             string
+var HistStoreFileName        string
 
 // Misc variables 
 
 var CurrentPID               string
+var HostName                 string
 
 var DirDelimiter             string
 var PathDelimiter            string
@@ -66,6 +68,8 @@ var ErrorEmails       []string
 
 var Resources         map[string]int
 
+var Priority          int
+
 
 // Local functions
 
@@ -80,6 +84,22 @@ func setPID () {
 	logger.Tracef("Current PID set to %s", CurrentPID)
 }
 
+func setHost () {
+	//
+	// Get the current host name used to tag lock and resource entries
+	//
+	logger.Trace("Getting current host name ...")
+
+	var err error
+
+	HostName, err = os.Hostname()
+	if err != nil {
+		logger.Errorf("Unable to get the host name - %s", err)
+	}
+
+	logger.Tracef("Host name set to %s", HostName)
+}
+
 func setDelimiter () {
 	//
 	// Get current OS
@@ -208,7 +228,7 @@ func setResourceFile () {
 
 	ResourceUsageFileName    = strings.Join([]string{ResourceFileName, UsedResSuffix}, ".")
 
-	ResourceObtainedFileName = strings.Join([]string{ResourceFileName, ObtainedResSuffix, CurrentPID}, ".")
+	ResourceObtainedFileName = strings.Join([]string{ResourceFileName, ObtainedResSuffix, HostName, CurrentPID}, ".")
 }
 
 func setRMANDir () {
@@ -230,6 +250,13 @@ func setHistFile () {
 	HistFileName = filepath.Join(LogDir, HistFileName)
 
 	logger.Tracef("History file set to %s", HistFileName)
+
+	// One JSON line per run read back by run_rman -history
+
+	HistStoreFileName = strings.Join([]string{BaseName, "history"}, ".")
+	HistStoreFileName = filepath.Join(LogDir, HistStoreFileName)
+
+	logger.Tracef("History store set to %s", HistStoreFileName)
 }
 
 // Global Functions
@@ -237,6 +264,8 @@ func setHistFile () {
 func Initialize() {
 	setPID()
 
+	setHost()
+
 	setDelimiter()
 
 	setBase()
@@ -268,6 +297,26 @@ func SetConfigFile (configFile string) {
 	logger.Debug("Process complete")
 }
 
+func SetSharedDir (sharedDir string) {
+	logger.Infof("Switching lock and resource usage files to shared directory %s ...", sharedDir)
+
+	//
+	// Lock and usage files must be visible to every host taking part so move them
+	// The resource definitions stay with the rest of the config
+	//
+
+	LockFileName = filepath.Join(sharedDir, filepath.Base(LockFileName))
+	logger.Tracef("Lock file set to %s", LockFileName)
+
+	ResourceUsageFileName = filepath.Join(sharedDir, filepath.Base(ResourceUsageFileName))
+	logger.Tracef("Resource usage file set to %s", ResourceUsageFileName)
+
+	ResourceObtainedFileName = filepath.Join(sharedDir, filepath.Base(ResourceObtainedFileName))
+	logger.Tracef("Resource obtained file set to %s", ResourceObtainedFileName)
+
+	logger.Debug("Process complete")
+}
+
 func SetLogDir (logDir string) {
 	logger.Infof("Switching log directory to new value %s ...", logDir)
 
@@ -282,6 +331,10 @@ func SetLogDir (logDir string) {
 	
 	SetLogFileName(filepath.Join(LogDir, logFile ))
 
+	// History lives with the logs
+
+	setHistFile()
+
 	logger.Debug("Process complete")
 }
 
@@ -353,6 +406,14 @@ func SetResource (resource string) {
 	logger.Debug("Process complete")
 }
 
+func SetPriority (priority int) {
+	logger.Infof("Setting queue priority to %d ...", priority)
+
+	Priority = priority
+
+	logger.Debugf("Priority set to %d", Priority)
+}
+
 func SetEmail (email string) {
 	logger.Info("Setting e-mail for all outcomes ...")
 
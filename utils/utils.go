@@ -5,6 +5,7 @@ package utils
 import "bufio"
 import "fmt"
 import "io"
+import "math/rand"
 import "os"
 import "os/signal"
 import "path/filepath"
@@ -22,6 +23,12 @@ import "github.com/daviesluke/mitchellh/go-ps"
 
 type fn func() 
 
+// Local variables
+
+// Seeded per process so waiters started together pick different intervals
+
+var jitterSource = rand.New(rand.NewSource(time.Now().UnixNano() + int64(os.Getpid())))
+
 // Global functions 
 
 func CheckRegEx(checkString string, regEx string) bool {
@@ -406,3 +413,78 @@ func CountLines( fileName string ) int {
 	
 	return lineCount
 }
+
+func WriteLines( fileName string, lines []string ) error {
+	logger.Debugf("Writing %d lines to file %s ...", len(lines), fileName)
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if _, err := file.WriteString(line+"\n"); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	logger.Debug("Process complete")
+
+	return file.Close()
+}
+
+func BackoffInterval( attempt int, minInterval time.Duration, maxInterval time.Duration ) time.Duration {
+	logger.Tracef("Calculating back off for attempt %d between %s and %s", attempt, minInterval, maxInterval)
+
+	// Double each attempt up to the maximum
+
+	backoffInterval := minInterval
+
+	for i := 0; i < attempt && backoffInterval < maxInterval; i++ {
+		backoffInterval *= 2
+	}
+
+	if backoffInterval > maxInterval {
+		backoffInterval = maxInterval
+	}
+
+	// Jitter by up to half so waiters started together do not keep polling together
+
+	if halfInterval := int64(backoffInterval / 2); halfInterval > 0 {
+		backoffInterval = time.Duration(halfInterval + jitterSource.Int63n(halfInterval + 1))
+	}
+
+	logger.Tracef("Returning %s", backoffInterval)
+
+	return backoffInterval
+}
+
+func PollWait( fileName string, attempt int, deadline time.Time, minInterval time.Duration, maxInterval time.Duration ) bool {
+	logger.Debugf("Checking whether to wait again for attempt %d ...", attempt)
+
+	remainingTime := time.Until(deadline)
+
+	if remainingTime <= 0 {
+		logger.Debug("Time out reached")
+		return false
+	}
+
+	// Never wait beyond the deadline so the final check happens on time
+
+	waitTime := BackoffInterval(attempt, minInterval, maxInterval)
+
+	if waitTime > remainingTime {
+		waitTime = remainingTime
+	}
+
+	logger.Infof("Sleeping for up to %s ...", waitTime.Round(time.Millisecond))
+
+	if WaitForChange(fileName, waitTime) {
+		logger.Info("Change detected. Checking again ...")
+	}
+
+	logger.Debug("Process complete")
+
+	return true
+}
@@ -0,0 +1,86 @@
+// +build linux
+
+package utils
+
+// Standard imports
+
+import "os"
+import "path/filepath"
+import "strings"
+import "syscall"
+import "time"
+import "unsafe"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+
+// Global functions
+
+func WaitForChange( fileName string, waitTime time.Duration ) bool {
+	logger.Debugf("Waiting up to %s for file %s to change ...", waitTime, fileName)
+
+	if fileName == "" {
+		time.Sleep(waitTime)
+		return false
+	}
+
+	// Files are replaced by rename and removed when empty so watch the directory for the name
+
+	inotifyFD, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		logger.Debugf("Unable to initialise inotify - %s. Sleeping instead", err)
+		time.Sleep(waitTime)
+		return false
+	}
+
+	// Non blocking descriptor lets the runtime poller honour the read deadline
+
+	inotifyFile := os.NewFile(uintptr(inotifyFD), "inotify")
+	defer inotifyFile.Close()
+
+	watchMask := uint32(syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_CREATE)
+
+	if _, err := syscall.InotifyAddWatch(inotifyFD, filepath.Dir(fileName), watchMask); err != nil {
+		logger.Debugf("Unable to watch directory %s - %s. Sleeping instead", filepath.Dir(fileName), err)
+		time.Sleep(waitTime)
+		return false
+	}
+
+	deadline := time.Now().Add(waitTime)
+
+	inotifyFile.SetReadDeadline(deadline)
+
+	eventBuffer := make([]byte, 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1))
+
+	for {
+		bytesRead, err := inotifyFile.Read(eventBuffer)
+		if err != nil {
+			if time.Now().Before(deadline) {
+				// Something other than the deadline went wrong - sleep out the rest
+
+				logger.Debugf("Unable to read inotify events - %s", err)
+				time.Sleep(time.Until(deadline))
+			}
+
+			logger.Debug("No change seen")
+			return false
+		}
+
+		for eventOffset := 0; eventOffset + syscall.SizeofInotifyEvent <= bytesRead; {
+			inotifyEvent := (*syscall.InotifyEvent)(unsafe.Pointer(&eventBuffer[eventOffset]))
+
+			nameStart := eventOffset + syscall.SizeofInotifyEvent
+			nameEnd   := nameStart + int(inotifyEvent.Len)
+
+			eventName := strings.TrimRight(string(eventBuffer[nameStart:nameEnd]), "\x00")
+
+			if eventName == filepath.Base(fileName) {
+				logger.Debugf("File %s changed", fileName)
+				return true
+			}
+
+			eventOffset = nameEnd
+		}
+	}
+}
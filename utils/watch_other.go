@@ -0,0 +1,23 @@
+// +build !linux
+
+package utils
+
+// Standard imports
+
+import "time"
+
+// Local imports
+
+import "github.com/daviesluke/logger"
+
+// Global functions
+
+func WaitForChange( fileName string, waitTime time.Duration ) bool {
+	logger.Debugf("Waiting %s before checking file %s again ...", waitTime, fileName)
+
+	// No change notification on this platform so just wait it out
+
+	time.Sleep(waitTime)
+
+	return false
+}